@@ -0,0 +1,157 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+// @see https://cloud.google.com/monitoring/api/ref_v3/rest/v3/projects.alertPolicies#Aligner
+var aligners = []string{
+	"ALIGN_NONE",
+	"ALIGN_DELTA",
+	"ALIGN_RATE",
+	"ALIGN_INTERPOLATE",
+	"ALIGN_NEXT_OLDER",
+	"ALIGN_MIN",
+	"ALIGN_MAX",
+	"ALIGN_MEAN",
+	"ALIGN_COUNT",
+	"ALIGN_SUM",
+	"ALIGN_STDDEV",
+	"ALIGN_COUNT_TRUE",
+	"ALIGN_COUNT_FALSE",
+	"ALIGN_FRACTION_TRUE",
+	"ALIGN_PERCENTILE_99",
+	"ALIGN_PERCENTILE_95",
+	"ALIGN_PERCENTILE_50",
+	"ALIGN_PERCENTILE_05",
+	"ALIGN_PERCENT_CHANGE",
+}
+
+// @see https://cloud.google.com/monitoring/api/ref_v3/rest/v3/projects.alertPolicies#Reducer
+var reducers = []string{
+	"REDUCE_NONE",
+	"REDUCE_MEAN",
+	"REDUCE_MIN",
+	"REDUCE_MAX",
+	"REDUCE_SUM",
+	"REDUCE_STDDEV",
+	"REDUCE_COUNT",
+	"REDUCE_COUNT_TRUE",
+	"REDUCE_COUNT_FALSE",
+	"REDUCE_FRACTION_TRUE",
+	"REDUCE_PERCENTILE_99",
+	"REDUCE_PERCENTILE_95",
+	"REDUCE_PERCENTILE_50",
+	"REDUCE_PERCENTILE_05",
+}
+
+// aggregation holds the server-side aggregation parameters of the Time
+// Series API calls.
+// @see https://cloud.google.com/monitoring/api/ref_v3/rest/v3/Aggregation
+type aggregation struct {
+	alignmentPeriod    time.Duration
+	perSeriesAligner   string
+	crossSeriesReducer string
+	groupByFields      []string
+	// secondary is applied to the Time Series resulting from the aggregation,
+	// ie to sum the deltas of several series aligned with ALIGN_DELTA
+	secondary *aggregation
+}
+
+func (a aggregation) configured() bool {
+	return a.alignmentPeriod != 0 || a.perSeriesAligner != "" || a.crossSeriesReducer != "" || len(a.groupByFields) > 0
+}
+
+func (a aggregation) aligned() bool {
+	return a.perSeriesAligner != "" && a.perSeriesAligner != "ALIGN_NONE"
+}
+
+func (a aggregation) reduced() bool {
+	return a.crossSeriesReducer != "" && a.crossSeriesReducer != "REDUCE_NONE"
+}
+
+// validate checks the combination of aggregation parameters is accepted by
+// the API.
+func (a aggregation) validate() error {
+	if a.alignmentPeriod < 0 {
+		return errors.New("alignment period must not be negative")
+	}
+	if a.aligned() && a.alignmentPeriod == 0 {
+		return fmt.Errorf("an alignment period is required by the %s per-series aligner", a.perSeriesAligner)
+	}
+	if !a.aligned() && a.alignmentPeriod > 0 {
+		return errors.New("an alignment period requires a per-series aligner")
+	}
+	if a.reduced() && !a.aligned() {
+		return fmt.Errorf("the %s cross-series reducer requires a per-series aligner", a.crossSeriesReducer)
+	}
+	if len(a.groupByFields) > 0 && !a.reduced() {
+		return errors.New("group by fields require a cross-series reducer")
+	}
+	if a.secondary != nil {
+		if !a.aligned() {
+			return errors.New("a secondary aggregation requires a per-series aligner")
+		}
+		if err := a.secondary.validate(); err != nil {
+			return fmt.Errorf("secondary aggregation: %v", err)
+		}
+	}
+	return nil
+}
+
+// rateAggregation returns the aggregation aligning the points of a metric as
+// a per-second rate over the given period.
+func rateAggregation(period time.Duration) aggregation {
+	return aggregation{
+		alignmentPeriod:  period,
+		perSeriesAligner: "ALIGN_RATE",
+	}
+}
+
+// apply sets the aggregation parameters on a Time Series API call.
+func (a aggregation) apply(call *monitoring.ProjectsTimeSeriesListCall) {
+	if a.alignmentPeriod > 0 {
+		call.AggregationAlignmentPeriod(fmt.Sprintf("%ds", int64(a.alignmentPeriod.Seconds())))
+	}
+	if a.perSeriesAligner != "" {
+		call.AggregationPerSeriesAligner(a.perSeriesAligner)
+	}
+	if a.crossSeriesReducer != "" {
+		call.AggregationCrossSeriesReducer(a.crossSeriesReducer)
+	}
+	if len(a.groupByFields) > 0 {
+		call.AggregationGroupByFields(a.groupByFields...)
+	}
+
+	if s := a.secondary; s != nil {
+		if s.alignmentPeriod > 0 {
+			call.SecondaryAggregationAlignmentPeriod(fmt.Sprintf("%ds", int64(s.alignmentPeriod.Seconds())))
+		}
+		if s.perSeriesAligner != "" {
+			call.SecondaryAggregationPerSeriesAligner(s.perSeriesAligner)
+		}
+		if s.crossSeriesReducer != "" {
+			call.SecondaryAggregationCrossSeriesReducer(s.crossSeriesReducer)
+		}
+		if len(s.groupByFields) > 0 {
+			call.SecondaryAggregationGroupByFields(s.groupByFields...)
+		}
+	}
+}
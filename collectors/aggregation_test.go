@@ -0,0 +1,81 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("aggregation", func() {
+	It("accepts no aggregation", func() {
+		Expect(aggregation{}.validate()).To(Succeed())
+	})
+
+	It("accepts an aligned and reduced aggregation", func() {
+		a := aggregation{
+			alignmentPeriod:    time.Minute,
+			perSeriesAligner:   "ALIGN_RATE",
+			crossSeriesReducer: "REDUCE_SUM",
+			groupByFields:      []string{"resource.label.zone"},
+		}
+		Expect(a.validate()).To(Succeed())
+	})
+
+	It("requires an alignment period for aligners", func() {
+		Expect(aggregation{perSeriesAligner: "ALIGN_MEAN"}.validate()).ToNot(Succeed())
+	})
+
+	It("requires an aligner for reducers", func() {
+		Expect(aggregation{crossSeriesReducer: "REDUCE_SUM"}.validate()).ToNot(Succeed())
+	})
+
+	It("requires a reducer for group by fields", func() {
+		a := aggregation{
+			alignmentPeriod:  time.Minute,
+			perSeriesAligner: "ALIGN_MEAN",
+			groupByFields:    []string{"resource.label.zone"},
+		}
+		Expect(a.validate()).ToNot(Succeed())
+	})
+
+	It("accepts a secondary aggregation of an aligned aggregation", func() {
+		a := aggregation{
+			alignmentPeriod:  time.Minute,
+			perSeriesAligner: "ALIGN_DELTA",
+			secondary: &aggregation{
+				alignmentPeriod:    time.Minute,
+				perSeriesAligner:   "ALIGN_SUM",
+				crossSeriesReducer: "REDUCE_SUM",
+			},
+		}
+		Expect(a.validate()).To(Succeed())
+	})
+
+	It("requires an aligner for secondary aggregations", func() {
+		a := aggregation{secondary: &aggregation{alignmentPeriod: time.Minute, perSeriesAligner: "ALIGN_SUM"}}
+		Expect(a.validate()).To(MatchError("a secondary aggregation requires a per-series aligner"))
+	})
+
+	It("validates the secondary aggregation", func() {
+		a := aggregation{
+			alignmentPeriod:  time.Minute,
+			perSeriesAligner: "ALIGN_DELTA",
+			secondary:        &aggregation{crossSeriesReducer: "REDUCE_SUM"},
+		}
+		Expect(a.validate()).To(MatchError(ContainSubstring("secondary aggregation: ")))
+	})
+})
@@ -0,0 +1,118 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CompressionTransport is an http.RoundTripper negotiating the compression of
+// the Google Stackdriver Monitoring API responses, and a collector exporting
+// the number of bytes received. Compressed responses are decompressed by the
+// transport itself, so the bytes are counted as received on the wire.
+type CompressionTransport struct {
+	next          http.RoundTripper
+	compression   bool
+	receivedBytes uint64
+	receivedDesc  *prometheus.Desc
+}
+
+func NewCompressionTransport(next http.RoundTripper, compression bool) *CompressionTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &CompressionTransport{
+		next:        next,
+		compression: compression,
+		receivedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(*collectorNamespace, *collectorSubsystem, "api_response_bytes_total"),
+			"Total number of bytes received in Google Stackdriver Monitoring API response bodies, before decompression.",
+			nil, nil,
+		),
+	}
+}
+
+func (t *CompressionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Setting the header stops the underlying transport from negotiating
+	// and decompressing gzip transparently
+	req = req.Clone(req.Context())
+	if t.compression {
+		req.Header.Set("Accept-Encoding", "gzip")
+	} else {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+
+	body := &countingBody{ReadCloser: resp.Body, count: &t.receivedBytes}
+	resp.Body = body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		resp.Body = &gzipBody{body: body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
+func (t *CompressionTransport) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.receivedDesc
+}
+
+func (t *CompressionTransport) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(t.receivedDesc, prometheus.CounterValue, float64(atomic.LoadUint64(&t.receivedBytes)))
+}
+
+// countingBody counts the bytes read from a response body.
+type countingBody struct {
+	io.ReadCloser
+	count *uint64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddUint64(b.count, uint64(n))
+	return n, err
+}
+
+// gzipBody decompresses a gzip response body, lazily so empty bodies can
+// still be closed without being read.
+type gzipBody struct {
+	body   io.ReadCloser
+	reader *gzip.Reader
+	err    error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.reader == nil && b.err == nil {
+		b.reader, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.reader.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
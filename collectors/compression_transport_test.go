@@ -0,0 +1,69 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CompressionTransport", func() {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write([]byte(`{"timeSeries":[]}`))
+	writer.Close()
+
+	// gzipServer replies with a compressed body when the request accepts it
+	gzipServer := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		if req.Header.Get("Accept-Encoding") == "gzip" {
+			resp.Header.Set("Content-Encoding", "gzip")
+			resp.Body = ioutil.NopCloser(bytes.NewReader(compressed.Bytes()))
+		} else {
+			resp.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"timeSeries":[]}`)))
+		}
+		return resp, nil
+	})
+
+	It("decompresses gzip responses and counts the compressed bytes", func() {
+		transport := NewCompressionTransport(gzipServer, true)
+		req, _ := http.NewRequest(http.MethodGet, "https://monitoring.googleapis.com/", nil)
+		resp, err := transport.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal(`{"timeSeries":[]}`))
+		Expect(resp.Header.Get("Content-Encoding")).To(BeEmpty())
+		Expect(transport.receivedBytes).To(Equal(uint64(compressed.Len())))
+		Expect(req.Header.Get("Accept-Encoding")).To(BeEmpty())
+	})
+
+	It("requests uncompressed responses when disabled", func() {
+		transport := NewCompressionTransport(gzipServer, false)
+		req, _ := http.NewRequest(http.MethodGet, "https://monitoring.googleapis.com/", nil)
+		resp, err := transport.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal(`{"timeSeries":[]}`))
+		Expect(transport.receivedBytes).To(Equal(uint64(len(body))))
+	})
+})
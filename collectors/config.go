@@ -0,0 +1,149 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds the inputs of the collectors loaded from a YAML file, as an
+// alternative to passing many prefixes and per-prefix options as flags.
+type Config struct {
+	MetricsTypePrefixes    []string                `yaml:"metrics_type_prefixes"`
+	MetricsTypes           []string                `yaml:"metrics_types"`
+	MetricsInterval        time.Duration           `yaml:"metrics_interval"`
+	MetricsOffset          time.Duration           `yaml:"metrics_offset"`
+	MonitoredResourceTypes []string                `yaml:"monitored_resource_types"`
+	PrefixOptions          map[string]PrefixConfig `yaml:"prefix_options"`
+}
+
+// PrefixConfig holds the options of the Metric Types starting with a prefix.
+type PrefixConfig struct {
+	Filter          string        `yaml:"filter"`
+	MetricsInterval time.Duration `yaml:"metrics_interval"`
+	ResourceTypes   []string      `yaml:"resource_types"`
+}
+
+// LoadConfig reads and validates a YAML config file.
+func LoadConfig(filename string) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %q: %v", filename, err)
+	}
+
+	config := &Config{}
+	if err := yaml.UnmarshalStrict(content, config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %q: %v", filename, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %q: %v", filename, err)
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	for _, list := range []struct {
+		field  string
+		values []string
+	}{
+		{"metrics_type_prefixes", c.MetricsTypePrefixes},
+		{"metrics_types", c.MetricsTypes},
+		{"monitored_resource_types", c.MonitoredResourceTypes},
+	} {
+		if err := validateListValues(list.values); err != nil {
+			return fmt.Errorf("`%s` is invalid: %v", list.field, err)
+		}
+	}
+	if c.MetricsInterval < 0 {
+		return errors.New("`metrics_interval` must not be negative")
+	}
+	if c.MetricsOffset < 0 {
+		return errors.New("`metrics_offset` must not be negative")
+	}
+
+	for prefix, options := range c.PrefixOptions {
+		if prefix == "" || strings.Contains(prefix, ":") {
+			return fmt.Errorf("`prefix_options` prefix %q must not be empty nor contain `:`", prefix)
+		}
+		if strings.Contains(options.Filter, "metric.type") {
+			return fmt.Errorf("`prefix_options` filter of prefix %q must not contain a `metric.type` clause", prefix)
+		}
+		if options.MetricsInterval < 0 {
+			return fmt.Errorf("`prefix_options` metrics interval of prefix %q must not be negative", prefix)
+		}
+		if err := validateListValues(options.ResourceTypes); err != nil {
+			return fmt.Errorf("`prefix_options` resource types of prefix %q are invalid: %v", prefix, err)
+		}
+	}
+	return nil
+}
+
+// validateListValues checks the values of a list can be joined into a comma
+// separated flag value.
+func validateListValues(values []string) error {
+	for _, value := range values {
+		if value == "" || strings.Contains(value, ",") {
+			return fmt.Errorf("value %q must not be empty nor contain commas", value)
+		}
+	}
+	return nil
+}
+
+// ApplyConfig sets the options from a config. The lists and durations set in
+// the config replace the flag values, while the prefix options are added to
+// the ones passed as flags, taking precedence for the same prefix.
+func (o *MonitoringCollectorOptions) ApplyConfig(config *Config) {
+	if len(config.MetricsTypePrefixes) > 0 {
+		o.MetricsTypePrefixes = config.MetricsTypePrefixes
+	}
+	if len(config.MetricsTypes) > 0 {
+		o.MetricsTypes = config.MetricsTypes
+	}
+	if config.MetricsInterval > 0 {
+		o.MetricsInterval = config.MetricsInterval
+	}
+	if config.MetricsOffset > 0 {
+		o.MetricsOffset = config.MetricsOffset
+	}
+	if len(config.MonitoredResourceTypes) > 0 {
+		o.MonitoredResourceTypes = config.MonitoredResourceTypes
+	}
+
+	for prefix, options := range config.PrefixOptions {
+		if options.Filter != "" {
+			if o.MetricsFilters == nil {
+				o.MetricsFilters = make(map[string]string)
+			}
+			o.MetricsFilters[prefix] = options.Filter
+		}
+		if options.MetricsInterval > 0 {
+			if o.MetricsIntervalOverrides == nil {
+				o.MetricsIntervalOverrides = make(map[string]time.Duration)
+			}
+			o.MetricsIntervalOverrides[prefix] = options.MetricsInterval
+		}
+		if len(options.ResourceTypes) > 0 {
+			if o.ResourceTypes == nil {
+				o.ResourceTypes = make(map[string][]string)
+			}
+			o.ResourceTypes[prefix] = options.ResourceTypes
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeConfig writes a config file and returns its path.
+func writeConfig(content string) string {
+	file, err := ioutil.TempFile("", "stackdriver_exporter_config")
+	Expect(err).ToNot(HaveOccurred())
+	defer file.Close()
+	_, err = file.WriteString(content)
+	Expect(err).ToNot(HaveOccurred())
+	return file.Name()
+}
+
+var _ = Describe("LoadConfig", func() {
+	It("loads the prefixes and their options", func() {
+		filename := writeConfig(`
+metrics_type_prefixes:
+  - compute.googleapis.com/instance/cpu
+  - pubsub.googleapis.com/
+metrics_interval: 10m
+prefix_options:
+  compute.googleapis.com/:
+    filter: resource.labels.zone="us-central1-a"
+    metrics_interval: 1m
+    resource_types: [gce_instance, k8s_node]
+`)
+		defer os.Remove(filename)
+
+		config, err := LoadConfig(filename)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(config.MetricsTypePrefixes).To(Equal([]string{"compute.googleapis.com/instance/cpu", "pubsub.googleapis.com/"}))
+		Expect(config.MetricsInterval).To(Equal(10 * time.Minute))
+		Expect(config.PrefixOptions).To(HaveKeyWithValue("compute.googleapis.com/", PrefixConfig{
+			Filter:          `resource.labels.zone="us-central1-a"`,
+			MetricsInterval: time.Minute,
+			ResourceTypes:   []string{"gce_instance", "k8s_node"},
+		}))
+	})
+
+	It("rejects unknown fields", func() {
+		filename := writeConfig("metrics_type_prefix: compute.googleapis.com/\n")
+		defer os.Remove(filename)
+
+		_, err := LoadConfig(filename)
+		Expect(err).To(MatchError(ContainSubstring("field metrics_type_prefix not found")))
+	})
+
+	It("rejects filters with a metric type clause", func() {
+		filename := writeConfig(`
+prefix_options:
+  compute.googleapis.com/:
+    filter: metric.type="compute.googleapis.com/instance/cpu/usage_time"
+`)
+		defer os.Remove(filename)
+
+		_, err := LoadConfig(filename)
+		Expect(err).To(MatchError(ContainSubstring("must not contain a `metric.type` clause")))
+	})
+
+	It("rejects values that can not be joined with commas", func() {
+		filename := writeConfig("metrics_types: [\"a,b\"]\n")
+		defer os.Remove(filename)
+
+		_, err := LoadConfig(filename)
+		Expect(err).To(MatchError(ContainSubstring("`metrics_types` is invalid")))
+	})
+
+	It("reports missing files", func() {
+		_, err := LoadConfig("/nonexistent/config.yml")
+		Expect(err).To(MatchError(ContainSubstring("error reading config file")))
+	})
+})
+
+var _ = Describe("MonitoringCollectorOptions.ApplyConfig", func() {
+	It("gives the config precedence over the flags for the same prefix", func() {
+		options := &MonitoringCollectorOptions{
+			MetricsTypePrefixes:      []string{"compute.googleapis.com/"},
+			MetricsInterval:          5 * time.Minute,
+			MetricsIntervalOverrides: map[string]time.Duration{"compute.googleapis.com/": 10 * time.Minute, "pubsub.googleapis.com/": time.Hour},
+			MetricsFilters:           map[string]string{"compute.googleapis.com/": `resource.labels.zone="us-east1-b"`},
+			ResourceTypes:            map[string][]string{"pubsub.googleapis.com/": {"pubsub_topic"}},
+		}
+
+		options.ApplyConfig(&Config{
+			MetricsTypePrefixes: []string{"compute.googleapis.com/", "pubsub.googleapis.com/"},
+			PrefixOptions: map[string]PrefixConfig{
+				"compute.googleapis.com/": {
+					Filter:          `resource.labels.zone="us-central1-a"`,
+					MetricsInterval: time.Minute,
+					ResourceTypes:   []string{"gce_instance"},
+				},
+			},
+		})
+
+		Expect(options.MetricsTypePrefixes).To(Equal([]string{"compute.googleapis.com/", "pubsub.googleapis.com/"}))
+		Expect(options.MetricsInterval).To(Equal(5 * time.Minute))
+		Expect(options.MetricsIntervalOverrides).To(Equal(map[string]time.Duration{
+			"compute.googleapis.com/": time.Minute,
+			"pubsub.googleapis.com/":  time.Hour,
+		}))
+		Expect(options.MetricsFilters).To(Equal(map[string]string{
+			"compute.googleapis.com/": `resource.labels.zone="us-central1-a"`,
+		}))
+		Expect(options.ResourceTypes).To(Equal(map[string][]string{
+			"compute.googleapis.com/": {"gce_instance"},
+			"pubsub.googleapis.com/":  {"pubsub_topic"},
+		}))
+	})
+})
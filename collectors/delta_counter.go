@@ -0,0 +1,205 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+type deltaCounter struct {
+	value float64
+	// count, sum and buckets hold the running totals of DISTRIBUTION series
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+	// endTimes holds the end time of the accumulated points, by start time
+	endTimes map[int64]time.Time
+	updated  time.Time
+	element  *list.Element
+}
+
+// deltaCounterStore turns DELTA metrics into monotonic counters by adding up
+// the points of each series across scrapes.
+//
+// One entry is kept per series for as long as it keeps being reported, so
+// memory grows with the number of DELTA series collected. Series not updated
+// within the TTL are evicted and start again from zero if they reappear. With
+// a max number of entries, the least recently updated series are evicted too
+// to stay within it.
+type deltaCounterStore struct {
+	ttl        time.Duration
+	maxEntries int
+	lock       sync.Mutex
+	counters   map[uint64]*deltaCounter
+	// lru holds the keys of the series, most recently updated first
+	lru       *list.List
+	evictions uint64
+}
+
+func newDeltaCounterStore(ttl time.Duration, maxEntries int) *deltaCounterStore {
+	return &deltaCounterStore{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		counters:   make(map[uint64]*deltaCounter),
+		lru:        list.New(),
+	}
+}
+
+// Accumulate adds the value of every point not accumulated yet to the running
+// total of the series, and returns the total.
+//
+// Points are told apart by their start time rather than by ending after the
+// last accumulated point: a series restarted with a new start time reports
+// points overlapping the ones already accumulated, which are added on top of
+// the total so the counter keeps increasing across the reset.
+func (s *deltaCounterStore) Accumulate(key uint64, valueType string, points []*monitoring.Point) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counter := s.counter(key)
+	s.addPoints(counter, points, func(point *monitoring.Point) bool {
+		value, ok := pointValue(valueType, point)
+		if ok {
+			counter.value += value
+		}
+		return ok
+	})
+	return counter.value
+}
+
+// AccumulateDistribution adds the count, sum and bucket counts of every
+// DISTRIBUTION point not accumulated yet to the running totals of the series,
+// and returns the totals. Points whose buckets can not be generated are
+// skipped.
+func (s *deltaCounterStore) AccumulateDistribution(key uint64, points []*monitoring.Point, generateBuckets func(*monitoring.Distribution) (map[float64]uint64, error)) (uint64, float64, map[float64]uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counter := s.counter(key)
+	s.addPoints(counter, points, func(point *monitoring.Point) bool {
+		if point.Value == nil || point.Value.DistributionValue == nil {
+			return false
+		}
+		dist := point.Value.DistributionValue
+		buckets, err := generateBuckets(dist)
+		if err != nil {
+			return false
+		}
+		if counter.buckets == nil {
+			counter.buckets = make(map[float64]uint64, len(buckets))
+		}
+		for bound, count := range buckets {
+			counter.buckets[bound] += count
+		}
+		counter.count += uint64(dist.Count)
+		counter.sum += dist.Mean * float64(dist.Count)
+		return true
+	})
+
+	buckets := make(map[float64]uint64, len(counter.buckets))
+	for bound, count := range counter.buckets {
+		buckets[bound] = count
+	}
+	return counter.count, counter.sum, buckets
+}
+
+// counter returns the entry of a series, creating it if needed.
+func (s *deltaCounterStore) counter(key uint64) *deltaCounter {
+	counter, ok := s.counters[key]
+	if ok {
+		s.lru.MoveToFront(counter.element)
+	} else {
+		counter = &deltaCounter{
+			endTimes: make(map[int64]time.Time),
+			element:  s.lru.PushFront(key),
+		}
+		s.counters[key] = counter
+		for s.maxEntries > 0 && len(s.counters) > s.maxEntries {
+			s.remove(s.lru.Back())
+			s.evictions++
+		}
+	}
+	return counter
+}
+
+// addPoints adds the points not accumulated yet to the entry of a series.
+func (s *deltaCounterStore) addPoints(counter *deltaCounter, points []*monitoring.Point, add func(*monitoring.Point) bool) {
+	var oldestEndTime time.Time
+	for _, point := range points {
+		if point.Interval == nil {
+			continue
+		}
+		endTime, err := time.Parse(time.RFC3339Nano, point.Interval.EndTime)
+		if err != nil {
+			continue
+		}
+		if oldestEndTime.IsZero() || endTime.Before(oldestEndTime) {
+			oldestEndTime = endTime
+		}
+		startTime := endTime
+		if point.Interval.StartTime != "" {
+			if startTime, err = time.Parse(time.RFC3339Nano, point.Interval.StartTime); err != nil {
+				continue
+			}
+		}
+		if _, ok := counter.endTimes[startTime.UnixNano()]; ok {
+			continue
+		}
+		if !add(point) {
+			continue
+		}
+		counter.endTimes[startTime.UnixNano()] = endTime
+	}
+
+	// Points ending before the oldest point requested are out of the
+	// interval for good, so they do not need to be told apart anymore
+	for startTime, endTime := range counter.endTimes {
+		if endTime.Before(oldestEndTime) {
+			delete(counter.endTimes, startTime)
+		}
+	}
+	counter.updated = time.Now()
+}
+
+// Evict removes the series not updated within the TTL.
+func (s *deltaCounterStore) Evict() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	deadline := time.Now().Add(-s.ttl)
+	for element := s.lru.Back(); element != nil; element = s.lru.Back() {
+		if !s.counters[element.Value.(uint64)].updated.Before(deadline) {
+			return
+		}
+		s.remove(element)
+	}
+}
+
+// Stats returns the number of series kept and the number of series evicted
+// so far to stay within the max number of entries.
+func (s *deltaCounterStore) Stats() (int, uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.counters), s.evictions
+}
+
+func (s *deltaCounterStore) remove(element *list.Element) {
+	delete(s.counters, element.Value.(uint64))
+	s.lru.Remove(element)
+}
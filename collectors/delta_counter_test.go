@@ -0,0 +1,140 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/monitoring/v3"
+)
+
+func deltaPoint(startTime string, endTime string, value int64) *monitoring.Point {
+	return &monitoring.Point{
+		Interval: &monitoring.TimeInterval{StartTime: startTime, EndTime: endTime},
+		Value:    &monitoring.TypedValue{Int64Value: &value},
+	}
+}
+
+var _ = Describe("deltaCounterStore", func() {
+	It("adds up points across scrapes without counting them twice", func() {
+		store := newDeltaCounterStore(time.Hour, 0)
+
+		total := store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 2),
+			deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		})
+		Expect(total).To(Equal(float64(3)))
+
+		total = store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:02:00Z", "2020-01-01T00:03:00Z", 4),
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 2),
+		})
+		Expect(total).To(Equal(float64(7)))
+
+		total = store.Accumulate(2, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:02:00Z", "2020-01-01T00:03:00Z", 5),
+		})
+		Expect(total).To(Equal(float64(5)))
+	})
+
+	It("keeps increasing across a series restarted with a new start time", func() {
+		store := newDeltaCounterStore(time.Hour, 0)
+
+		total := store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 2),
+			deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		})
+		Expect(total).To(Equal(float64(3)))
+
+		total = store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:01:30Z", "2020-01-01T00:01:45Z", 5),
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 2),
+		})
+		Expect(total).To(Equal(float64(8)))
+
+		total = store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:01:45Z", "2020-01-01T00:02:45Z", 1),
+			deltaPoint("2020-01-01T00:01:30Z", "2020-01-01T00:01:45Z", 5),
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 2),
+		})
+		Expect(total).To(Equal(float64(9)))
+	})
+
+	It("forgets the points out of the requested interval", func() {
+		store := newDeltaCounterStore(time.Hour, 0)
+		store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		})
+		store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 1),
+		})
+		Expect(store.counters[1].endTimes).To(HaveLen(1))
+	})
+
+	It("evicts series not updated within the TTL", func() {
+		store := newDeltaCounterStore(-time.Minute, 0)
+		store.Accumulate(1, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		})
+		store.Evict()
+		Expect(store.counters).To(BeEmpty())
+		Expect(store.lru.Len()).To(BeZero())
+	})
+
+	It("evicts the least recently updated series beyond the max entries", func() {
+		store := newDeltaCounterStore(time.Hour, 2)
+		for _, key := range []uint64{1, 2, 1, 3} {
+			store.Accumulate(key, "INT64", []*monitoring.Point{
+				deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+			})
+		}
+		Expect(store.counters).To(HaveKey(uint64(1)))
+		Expect(store.counters).To(HaveKey(uint64(3)))
+
+		entries, evictions := store.Stats()
+		Expect(entries).To(Equal(2))
+		Expect(evictions).To(Equal(uint64(1)))
+
+		total := store.Accumulate(2, "INT64", []*monitoring.Point{
+			deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		})
+		Expect(total).To(Equal(float64(1)))
+	})
+
+	It("adds up the count, sum and buckets of distribution points", func() {
+		store := newDeltaCounterStore(time.Hour, 0)
+		distPoint := func(startTime string, endTime string, count int64) *monitoring.Point {
+			return &monitoring.Point{
+				Interval: &monitoring.TimeInterval{StartTime: startTime, EndTime: endTime},
+				Value:    &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{Count: count, Mean: 2}},
+			}
+		}
+		generateBuckets := func(dist *monitoring.Distribution) (map[float64]uint64, error) {
+			return map[float64]uint64{5: uint64(dist.Count)}, nil
+		}
+
+		store.AccumulateDistribution(1, []*monitoring.Point{
+			distPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		}, generateBuckets)
+		count, sum, buckets := store.AccumulateDistribution(1, []*monitoring.Point{
+			distPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 3),
+			distPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		}, generateBuckets)
+		Expect(count).To(Equal(uint64(4)))
+		Expect(sum).To(Equal(float64(8)))
+		Expect(buckets).To(Equal(map[float64]uint64{5: 4}))
+	})
+})
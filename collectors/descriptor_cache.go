@@ -0,0 +1,78 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"sync"
+	"time"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+type descriptorCacheEntry struct {
+	descriptors []*monitoring.MetricDescriptor
+	expiry      time.Time
+}
+
+// descriptorCache keeps the metric descriptors listed for each metric type
+// prefix for a limited amount of time, so they do not need to be listed on
+// every scrape. Without a TTL they are kept forever.
+type descriptorCache struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]*descriptorCacheEntry
+}
+
+func newDescriptorCache(ttl time.Duration) *descriptorCache {
+	return &descriptorCache{
+		ttl:     ttl,
+		entries: make(map[string]*descriptorCacheEntry),
+	}
+}
+
+// Lookup returns the cached descriptors for a prefix, if not expired.
+func (d *descriptorCache) Lookup(prefix string) ([]*monitoring.MetricDescriptor, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	entry, ok := d.entries[prefix]
+	if !ok {
+		return nil, false
+	}
+	if d.ttl != 0 && time.Now().After(entry.expiry) {
+		delete(d.entries, prefix)
+		return nil, false
+	}
+	return entry.descriptors, true
+}
+
+// Store caches the descriptors for a prefix.
+func (d *descriptorCache) Store(prefix string, descriptors []*monitoring.MetricDescriptor) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.entries[prefix] = &descriptorCacheEntry{
+		descriptors: descriptors,
+		expiry:      time.Now().Add(d.ttl),
+	}
+}
+
+// Len returns the number of cached entries, including the expired ones not
+// looked up since.
+func (d *descriptorCache) Len() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return len(d.entries)
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/monitoring/v3"
+)
+
+var _ = Describe("descriptorCache", func() {
+	descriptors := []*monitoring.MetricDescriptor{
+		{Type: "compute.googleapis.com/instance/cpu/usage_time"},
+	}
+
+	It("returns stored descriptors", func() {
+		cache := newDescriptorCache(time.Minute)
+		cache.Store("compute.googleapis.com/", descriptors)
+
+		cached, ok := cache.Lookup("compute.googleapis.com/")
+		Expect(ok).To(BeTrue())
+		Expect(cached).To(Equal(descriptors))
+
+		_, ok = cache.Lookup("pubsub.googleapis.com/")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("does not return expired descriptors", func() {
+		cache := newDescriptorCache(-time.Minute)
+		cache.Store("compute.googleapis.com/", descriptors)
+
+		_, ok := cache.Lookup("compute.googleapis.com/")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("keeps descriptors forever without a TTL", func() {
+		cache := newDescriptorCache(0)
+		cache.Store("compute.googleapis.com/", descriptors)
+
+		_, ok := cache.Lookup("compute.googleapis.com/")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("counts the cached entries", func() {
+		cache := newDescriptorCache(time.Minute)
+		Expect(cache.Len()).To(Equal(0))
+
+		cache.Store("compute.googleapis.com/instance/cpu/usage_time", descriptors)
+		cache.Store("compute.googleapis.com/instance/uptime", descriptors)
+		Expect(cache.Len()).To(Equal(2))
+	})
+})
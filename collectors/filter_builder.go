@@ -0,0 +1,47 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"google.golang.org/api/monitoring/v3"
+)
+
+// FilterBuilder returns the Time Series filter sent to the Google Stackdriver
+// Monitoring API for a Metric Type, given the filter the collector assembled
+// for it, ie to append custom clauses or log the filter.
+//
+// Builders are called concurrently for different metric types.
+type FilterBuilder func(metricType string, filter string) string
+
+// DefaultFilterBuilder sends the filters as the collector assembled them.
+func DefaultFilterBuilder(metricType string, filter string) string {
+	return filter
+}
+
+// SetFilterBuilder sets the builder of the Time Series filters. Metric Types
+// are not batched with a builder set, so every filter selects a single Metric
+// Type. It must be called before the collector is registered.
+func (c *MonitoringCollector) SetFilterBuilder(builder FilterBuilder) {
+	c.filterBuilder = builder
+}
+
+// timeSeriesListFilter returns the filter to list the Time Series of a batch
+// of descriptors, passed through the filter builder if any.
+func (c *MonitoringCollector) timeSeriesListFilter(batch []*monitoring.MetricDescriptor) string {
+	filter := c.batchTimeSeriesFilter(batch)
+	if c.filterBuilder != nil {
+		filter = c.filterBuilder(batch[0].Type, filter)
+	}
+	return filter
+}
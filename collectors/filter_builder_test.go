@@ -0,0 +1,55 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/monitoring/v3"
+)
+
+var _ = Describe("FilterBuilder", func() {
+	descriptors := map[string]*monitoring.MetricDescriptor{
+		"compute.googleapis.com/instance/cpu/usage_time":  {Type: "compute.googleapis.com/instance/cpu/usage_time"},
+		"compute.googleapis.com/instance/cpu/utilization": {Type: "compute.googleapis.com/instance/cpu/utilization"},
+	}
+
+	It("sends the assembled filter without a builder", func() {
+		c := &MonitoringCollector{}
+		Expect(c.timeSeriesListFilter([]*monitoring.MetricDescriptor{testDescriptor})).To(Equal(
+			`metric.type="compute.googleapis.com/instance/cpu/utilization"`,
+		))
+	})
+
+	It("sends the filter returned by the builder", func() {
+		c := &MonitoringCollector{}
+		var builtType string
+		c.SetFilterBuilder(func(metricType string, filter string) string {
+			builtType = metricType
+			return filter + ` AND metric.labels.state="used"`
+		})
+		Expect(c.timeSeriesListFilter([]*monitoring.MetricDescriptor{testDescriptor})).To(Equal(
+			`metric.type="compute.googleapis.com/instance/cpu/utilization" AND metric.labels.state="used"`,
+		))
+		Expect(builtType).To(Equal(testDescriptor.Type))
+	})
+
+	It("does not batch descriptors with a builder set", func() {
+		c := &MonitoringCollector{descriptorsBatchSize: 10}
+		Expect(c.batchDescriptors(descriptors)).To(HaveLen(1))
+
+		c.SetFilterBuilder(DefaultFilterBuilder)
+		Expect(c.batchDescriptors(descriptors)).To(HaveLen(2))
+	})
+})
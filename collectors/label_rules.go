@@ -0,0 +1,93 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus-community/stackdriver_exporter/utils"
+)
+
+var labelNameRE = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+// labelRules renames and drops labels of the reported metrics, ie to match
+// the label names of other exporters.
+type labelRules struct {
+	renames map[string]string
+	drops   map[string]bool
+}
+
+// newLabelRules parses `label:new_label` renames and the labels to drop,
+// rejecting renames that would make two labels collide.
+func newLabelRules(renames []string, drops []string) (*labelRules, error) {
+	renameMap, err := utils.ParsePrefixMap(renames)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &labelRules{
+		renames: renameMap,
+		drops:   make(map[string]bool, len(drops)),
+	}
+	for _, label := range drops {
+		rules.drops[label] = true
+	}
+
+	renamedFrom := make(map[string]string, len(renameMap))
+	for from, to := range renameMap {
+		if !labelNameRE.MatchString(to) {
+			return nil, fmt.Errorf("invalid label name %q to rename %q to", to, from)
+		}
+		if previous, ok := renamedFrom[to]; ok {
+			return nil, fmt.Errorf("labels %q and %q are both renamed to %q", previous, from, to)
+		}
+		if rules.drops[to] {
+			return nil, fmt.Errorf("label %q is renamed to the dropped label %q", from, to)
+		}
+		renamedFrom[to] = from
+	}
+
+	return rules, nil
+}
+
+// apply returns the label pairs with the rules applied. A label is not
+// renamed if its new name is already in use by a label kept as is.
+func (r *labelRules) apply(labelKeys []string, labelValues []string) ([]string, []string) {
+	if r == nil || (len(r.renames) == 0 && len(r.drops) == 0) {
+		return labelKeys, labelValues
+	}
+
+	keys := make([]string, 0, len(labelKeys))
+	values := make([]string, 0, len(labelValues))
+	kept := make(map[string]bool, len(labelKeys))
+	for _, key := range labelKeys {
+		if !r.drops[key] {
+			if _, renamed := r.renames[key]; !renamed {
+				kept[key] = true
+			}
+		}
+	}
+	for i, key := range labelKeys {
+		if r.drops[key] {
+			continue
+		}
+		if to, ok := r.renames[key]; ok && !kept[to] {
+			key = to
+		}
+		keys = append(keys, key)
+		values = append(values, labelValues[i])
+	}
+	return keys, values
+}
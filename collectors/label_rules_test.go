@@ -0,0 +1,49 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("labelRules", func() {
+	It("renames and drops labels", func() {
+		rules, err := newLabelRules([]string{"instance_id:instance"}, []string{"project_id"})
+		Expect(err).ToNot(HaveOccurred())
+
+		keys, values := rules.apply([]string{"unit", "project_id", "instance_id"}, []string{"1", "test", "42"})
+		Expect(keys).To(Equal([]string{"unit", "instance"}))
+		Expect(values).To(Equal([]string{"1", "42"}))
+	})
+
+	It("does not rename a label to the name of a label kept as is", func() {
+		rules, err := newLabelRules([]string{"instance_id:zone"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		keys, _ := rules.apply([]string{"zone", "instance_id"}, []string{"us-central1-a", "42"})
+		Expect(keys).To(Equal([]string{"zone", "instance_id"}))
+	})
+
+	It("rejects renames that would collide", func() {
+		_, err := newLabelRules([]string{"instance_id:instance", "instance_name:instance"}, nil)
+		Expect(err).To(HaveOccurred())
+
+		_, err = newLabelRules([]string{"instance_id:instance"}, []string{"instance"})
+		Expect(err).To(HaveOccurred())
+
+		_, err = newLabelRules([]string{"instance_id:instance-id"}, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
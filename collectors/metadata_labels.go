@@ -0,0 +1,132 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/monitoring/v3"
+)
+
+var invalidLabelCharsRE = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// metadataLabels flattens the system and user labels of the monitored
+// resource metadata of a Time Series into `metadata_system_` and
+// `metadata_user_` prefixed labels. System label lists are joined with
+// commas, and nested objects are skipped.
+func metadataLabels(metadata *monitoring.MonitoredResourceMetadata) (map[string]string, error) {
+	labels := make(map[string]string)
+	if metadata == nil {
+		return labels, nil
+	}
+
+	if len(metadata.SystemLabels) > 0 {
+		var systemLabels map[string]interface{}
+		if err := json.Unmarshal(metadata.SystemLabels, &systemLabels); err != nil {
+			return nil, err
+		}
+		for key, value := range systemLabels {
+			if labelValue, ok := metadataLabelValue(value); ok {
+				labels[metadataLabelKey("metadata_system_", key)] = labelValue
+			}
+		}
+	}
+
+	for key, value := range metadata.UserLabels {
+		labels[metadataLabelKey("metadata_user_", key)] = value
+	}
+
+	return labels, nil
+}
+
+// metadataLabelPrefixes maps the fields of the monitored resource metadata to
+// the prefix of the labels they are reported as.
+var metadataLabelPrefixes = map[string]string{
+	"system_labels": "metadata_system_",
+	"user_labels":   "metadata_user_",
+}
+
+// validateMetadataLabels checks the metadata labels to report are named as
+// `system_labels.<key>` or `user_labels.<key>`.
+func validateMetadataLabels(names []string) error {
+	for _, name := range names {
+		parts := strings.SplitN(name, ".", 2)
+		if _, ok := metadataLabelPrefixes[parts[0]]; !ok || len(parts) != 2 || parts[1] == "" {
+			return fmt.Errorf("metadata label %q is not named as `system_labels.<key>` or `user_labels.<key>`", name)
+		}
+	}
+	return nil
+}
+
+// withMetadataGroupByFields returns the aggregation also grouping by the
+// metadata labels to report, as the Time Series API only returns the metadata
+// labels named in a cross-series reduction.
+func withMetadataGroupByFields(a aggregation, names []string) (aggregation, error) {
+	if len(names) == 0 {
+		return a, nil
+	}
+	if !a.reduced() {
+		return a, errors.New("metadata labels require a cross-series reducer")
+	}
+	fields := make([]string, 0, len(names)+len(a.groupByFields))
+	for _, name := range names {
+		fields = append(fields, "metadata."+name)
+	}
+	a.groupByFields = append(fields, a.groupByFields...)
+	return a, nil
+}
+
+// withMetadataLabels returns the metadata labels of a series including every
+// metadata label to report, empty when missing, so the label set of the
+// metric does not change when some series lack a label.
+func withMetadataLabels(names []string, labels map[string]string) map[string]string {
+	result := make(map[string]string, len(labels)+len(names))
+	for _, name := range names {
+		parts := strings.SplitN(name, ".", 2)
+		result[metadataLabelKey(metadataLabelPrefixes[parts[0]], parts[1])] = ""
+	}
+	for key, value := range labels {
+		result[key] = value
+	}
+	return result
+}
+
+func metadataLabelKey(prefix string, key string) string {
+	return prefix + invalidLabelCharsRE.ReplaceAllLiteralString(key, "_")
+}
+
+func metadataLabelValue(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if itemValue, ok := metadataLabelValue(item); ok {
+				values = append(values, itemValue)
+			}
+		}
+		return strings.Join(values, ","), true
+	}
+	return "", false
+}
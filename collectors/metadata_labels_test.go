@@ -0,0 +1,108 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/api/monitoring/v3"
+)
+
+var _ = Describe("metadataLabels", func() {
+	It("flattens the system and user labels", func() {
+		labels, err := metadataLabels(&monitoring.MonitoredResourceMetadata{
+			SystemLabels: []byte(`{"machine_type":"n1-standard-1","spot_instance":false,"network":["default","internal"],"top_level_controller":{"type":"Deployment"}}`),
+			UserLabels:   map[string]string{"cost-center": "42"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(labels).To(Equal(map[string]string{
+			"metadata_system_machine_type":  "n1-standard-1",
+			"metadata_system_spot_instance": "false",
+			"metadata_system_network":       "default,internal",
+			"metadata_user_cost_center":     "42",
+		}))
+	})
+
+	It("returns no labels without metadata", func() {
+		labels, err := metadataLabels(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(labels).To(BeEmpty())
+	})
+
+	It("fails on malformed system labels", func() {
+		_, err := metadataLabels(&monitoring.MonitoredResourceMetadata{SystemLabels: []byte(`[`)})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("validateMetadataLabels", func() {
+	It("accepts system and user labels", func() {
+		Expect(validateMetadataLabels([]string{"system_labels.machine_type", "user_labels.env"})).To(Succeed())
+	})
+
+	It("rejects other fields and missing keys", func() {
+		Expect(validateMetadataLabels([]string{"machine_type"})).ToNot(Succeed())
+		Expect(validateMetadataLabels([]string{"resource_labels.zone"})).ToNot(Succeed())
+		Expect(validateMetadataLabels([]string{"user_labels."})).ToNot(Succeed())
+	})
+})
+
+var _ = Describe("withMetadataGroupByFields", func() {
+	reduced := aggregation{
+		alignmentPeriod:    time.Minute,
+		perSeriesAligner:   "ALIGN_MEAN",
+		crossSeriesReducer: "REDUCE_SUM",
+		groupByFields:      []string{"resource.zone"},
+	}
+
+	It("groups the reduction by the metadata labels", func() {
+		a, err := withMetadataGroupByFields(reduced, []string{"system_labels.machine_type", "user_labels.env"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.groupByFields).To(Equal([]string{
+			"metadata.system_labels.machine_type",
+			"metadata.user_labels.env",
+			"resource.zone",
+		}))
+		Expect(a.validate()).To(Succeed())
+		Expect(reduced.groupByFields).To(Equal([]string{"resource.zone"}))
+	})
+
+	It("keeps the aggregation without metadata labels", func() {
+		a, err := withMetadataGroupByFields(aggregation{}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a).To(Equal(aggregation{}))
+	})
+
+	It("rejects the metadata labels without a cross-series reducer", func() {
+		_, err := withMetadataGroupByFields(aggregation{}, []string{"system_labels.machine_type"})
+		Expect(err).To(MatchError(ContainSubstring("require a cross-series reducer")))
+
+		_, err = withMetadataGroupByFields(aggregation{perSeriesAligner: "ALIGN_MEAN", alignmentPeriod: time.Minute, crossSeriesReducer: "REDUCE_NONE"}, []string{"system_labels.machine_type"})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("withMetadataLabels", func() {
+	It("adds the missing metadata labels with an empty value", func() {
+		labels := withMetadataLabels([]string{"system_labels.machine_type", "user_labels.cost-center"}, map[string]string{
+			"metadata_system_machine_type": "n1-standard-1",
+		})
+		Expect(labels).To(Equal(map[string]string{
+			"metadata_system_machine_type": "n1-standard-1",
+			"metadata_user_cost_center":    "",
+		}))
+	})
+})
@@ -0,0 +1,53 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/monitoring/v3"
+)
+
+// MetricTransformer reshapes Time Series before the collector reports them,
+// ie to split a composite label or scale a value.
+//
+// Transform is called for every Time Series retrieved. When it returns true
+// the collector reports the returned metrics instead of the Time Series,
+// otherwise the Time Series is reported as usual and the metrics are ignored.
+// Transformers are called concurrently for different metric types.
+type MetricTransformer interface {
+	Transform(timeSeries *monitoring.TimeSeries, metricDescriptor *monitoring.MetricDescriptor) ([]prometheus.Metric, bool)
+}
+
+// AddMetricTransformer adds a transformer called, in the order they were
+// added, before the default handling of every Time Series. It must be called
+// before the collector is registered.
+func (c *MonitoringCollector) AddMetricTransformer(transformer MetricTransformer) {
+	c.metricTransformers = append(c.metricTransformers, transformer)
+}
+
+// transformTimeSeries reports the metrics of the first transformer handling a
+// Time Series, if any.
+func (c *MonitoringCollector) transformTimeSeries(timeSeries *monitoring.TimeSeries, metricDescriptor *monitoring.MetricDescriptor, ch chan<- prometheus.Metric) bool {
+	for _, transformer := range c.metricTransformers {
+		metrics, handled := transformer.Transform(timeSeries, metricDescriptor)
+		if !handled {
+			continue
+		}
+		for _, metric := range metrics {
+			ch <- metric
+		}
+		return true
+	}
+	return false
+}
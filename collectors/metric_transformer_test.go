@@ -0,0 +1,58 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/api/monitoring/v3"
+)
+
+type testTransformer func(*monitoring.TimeSeries, *monitoring.MetricDescriptor) ([]prometheus.Metric, bool)
+
+func (t testTransformer) Transform(timeSeries *monitoring.TimeSeries, metricDescriptor *monitoring.MetricDescriptor) ([]prometheus.Metric, bool) {
+	return t(timeSeries, metricDescriptor)
+}
+
+var _ = Describe("MetricTransformer", func() {
+	var c *MonitoringCollector
+
+	BeforeEach(func() {
+		c = newTestCollector()
+	})
+
+	It("reports the metrics of a transformer handling a time series", func() {
+		c.AddMetricTransformer(testTransformer(func(timeSeries *monitoring.TimeSeries, _ *monitoring.MetricDescriptor) ([]prometheus.Metric, bool) {
+			desc := prometheus.NewDesc("scaled", "Scaled value.", nil, nil)
+			value := float64(*timeSeries.Points[0].Value.Int64Value) * 100
+			return []prometheus.Metric{prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)}, true
+		}))
+
+		metrics := reportTimeSeries(c, testDescriptor, int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 2))
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(200)))
+		Expect(metrics[0].GetLabel()).To(BeEmpty())
+	})
+
+	It("reports the time series when no transformer handles it", func() {
+		c.AddMetricTransformer(testTransformer(func(*monitoring.TimeSeries, *monitoring.MetricDescriptor) ([]prometheus.Metric, bool) {
+			return nil, false
+		}))
+
+		metrics := reportTimeSeries(c, testDescriptor, int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 2))
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("instance_id", "1"))
+	})
+})
@@ -17,13 +17,17 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"golang.org/x/net/context"
 	"google.golang.org/api/monitoring/v3"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -32,135 +36,1224 @@ import (
 )
 
 var (
+	collectorNamespace = kingpin.Flag(
+		"collector.namespace", "Namespace of the exported metrics ($STACKDRIVER_EXPORTER_COLLECTOR_NAMESPACE).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_NAMESPACE").Default("stackdriver").String()
+
+	collectorSubsystem = kingpin.Flag(
+		"collector.subsystem", "Subsystem of the exporter's own metrics, Google Stackdriver Monitoring metrics use their monitored resource type ($STACKDRIVER_EXPORTER_COLLECTOR_SUBSYSTEM).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_SUBSYSTEM").Default("monitoring").String()
+
 	monitoringMetricsTypePrefixes = kingpin.Flag(
 		"monitoring.metrics-type-prefixes", "Comma separated Google Stackdriver Monitoring Metric Type prefixes ($STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_PREFIXES).",
-	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_PREFIXES").Required().String()
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_PREFIXES").String()
+
+	monitoringMetricsTypes = kingpin.Flag(
+		"monitoring.metrics-types", "Comma separated Google Stackdriver Monitoring Metric Types to collect without listing the Metric Descriptors of a prefix ($STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPES).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPES").String()
+
+	monitoringDescriptorsProjectID = kingpin.Flag(
+		"monitoring.descriptors-project-id", "Google Project ID to list the Google Stackdriver Monitoring Metric Descriptors from when collecting an organization or a folder ($STACKDRIVER_EXPORTER_MONITORING_DESCRIPTORS_PROJECT_ID).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_DESCRIPTORS_PROJECT_ID").String()
 
 	monitoringMetricsInterval = kingpin.Flag(
 		"monitoring.metrics-interval", "Interval to request the Google Stackdriver Monitoring Metrics for. Only the most recent data point is used ($STACKDRIVER_EXPORTER_MONITORING_METRICS_INTERVAL).",
 	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_INTERVAL").Default("5m").Duration()
 
+	monitoringMetricsIntervalOverrides = kingpin.Flag(
+		"monitoring.metrics-interval-override", "Interval to request the Google Stackdriver Monitoring Metrics starting with a prefix for, as `prefix:interval`. Repeatable ($STACKDRIVER_EXPORTER_MONITORING_METRICS_INTERVAL_OVERRIDE).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_INTERVAL_OVERRIDE").Strings()
+
+	monitoringLookbackMultiplier = kingpin.Flag(
+		"monitoring.lookback-multiplier", "Multiple of the metrics interval to request the Google Stackdriver Monitoring Metrics for, so metrics written less often than the interval are still found. Above 1, the pages of a listing are merged and only the freshest point of each series is reported ($STACKDRIVER_EXPORTER_MONITORING_LOOKBACK_MULTIPLIER).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_LOOKBACK_MULTIPLIER").Default("1").Float64()
+
 	monitoringMetricsOffset = kingpin.Flag(
 		"monitoring.metrics-offset", "Offset for the Google Stackdriver Monitoring Metrics interval into the past ($STACKDRIVER_EXPORTER_MONITORING_METRICS_OFFSET).",
 	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_OFFSET").Default("0s").Duration()
 
+	monitoringIntervalStart = kingpin.Flag(
+		"monitoring.interval-start", "Fixed start of the Google Stackdriver Monitoring Metrics interval, as a RFC 3339 time, instead of the metrics interval before now. Requires `monitoring.interval-end` ($STACKDRIVER_EXPORTER_MONITORING_INTERVAL_START).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_INTERVAL_START").String()
+
+	monitoringIntervalEnd = kingpin.Flag(
+		"monitoring.interval-end", "Fixed end of the Google Stackdriver Monitoring Metrics interval, as a RFC 3339 time, instead of now minus the metrics offset. Requires `monitoring.interval-start` ($STACKDRIVER_EXPORTER_MONITORING_INTERVAL_END).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_INTERVAL_END").String()
+
 	collectorFillMissingLabels = kingpin.Flag(
 		"collector.fill-missing-labels", "Fill missing metrics labels with empty string to avoid label dimensions inconsistent failure ($STACKDRIVER_EXPORTER_COLLECTOR_FILL_MISSING_LABELS).",
 	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_FILL_MISSING_LABELS").Default("true").Bool()
 
+	collectorDropEmptyLabels = kingpin.Flag(
+		"collector.drop-empty-labels", "Drop the labels with an empty value instead of reporting them, unless required by `collector.fill-missing-labels` for other series of the same metric ($STACKDRIVER_EXPORTER_COLLECTOR_DROP_EMPTY_LABELS).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_DROP_EMPTY_LABELS").Default("false").Bool()
+
 	monitoringDropDelegatedProjects = kingpin.Flag(
 		"monitoring.drop-delegated-projects", "Drop metrics from attached projects and fetch `project_id` only ($STACKDRIVER_EXPORTER_DROP_DELEGATED_PROJECTS).",
 	).Envar("STACKDRIVER_EXPORTER_DROP_DELEGATED_PROJECTS").Default("false").Bool()
+
+	monitoringRequestTimeout = kingpin.Flag(
+		"monitoring.request-timeout", "Deadline for each Google Stackdriver Monitoring API request, 0 means no deadline ($STACKDRIVER_EXPORTER_MONITORING_REQUEST_TIMEOUT).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_REQUEST_TIMEOUT").Default("0s").Duration()
+
+	monitoringScrapeTimeout = kingpin.Flag(
+		"monitoring.scrape-timeout", "Deadline for a whole scrape of Google Stackdriver Monitoring, the metrics collected by then are reported and the scrape is marked as failed, 0 means no deadline ($STACKDRIVER_EXPORTER_MONITORING_SCRAPE_TIMEOUT).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SCRAPE_TIMEOUT").Default("0s").Duration()
+
+	monitoringMaxConcurrentRequests = kingpin.Flag(
+		"monitoring.max-concurrent-requests", "Max number of concurrent Google Stackdriver Monitoring API calls across all prefixes and descriptors, 0 means unlimited ($STACKDRIVER_EXPORTER_MONITORING_MAX_CONCURRENT_REQUESTS).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_MAX_CONCURRENT_REQUESTS").Default("0").Int()
+
+	monitoringMaxConcurrentPrefixes = kingpin.Flag(
+		"monitoring.max-concurrent-prefixes", "Max number of Google Stackdriver Monitoring Metric Type prefixes collected concurrently, 0 means unlimited ($STACKDRIVER_EXPORTER_MONITORING_MAX_CONCURRENT_PREFIXES).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_MAX_CONCURRENT_PREFIXES").Default("0").Int()
+
+	monitoringPrefixJitter = kingpin.Flag(
+		"monitoring.prefix-jitter", "Max random delay before scraping each Google Stackdriver Monitoring Metric Type prefix, to spread the API calls over the scrape, 0 disables it ($STACKDRIVER_EXPORTER_MONITORING_PREFIX_JITTER).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_PREFIX_JITTER").Default("0s").Duration()
+
+	monitoringMaxDescriptorsPerPrefix = kingpin.Flag(
+		"monitoring.max-descriptors-per-prefix", "Max number of Google Stackdriver Monitoring Metric Descriptors to collect per prefix, in Metric Type order, 0 means unlimited ($STACKDRIVER_EXPORTER_MONITORING_MAX_DESCRIPTORS_PER_PREFIX).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_MAX_DESCRIPTORS_PER_PREFIX").Default("0").Int()
+
+	monitoringDescriptorCacheTTL = kingpin.Flag(
+		"monitoring.descriptor-cache-ttl", "How long the Google Stackdriver Monitoring Metric Descriptors listed for a prefix are cached, 0 disables the cache ($STACKDRIVER_EXPORTER_MONITORING_DESCRIPTOR_CACHE_TTL).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_DESCRIPTOR_CACHE_TTL").Default("0s").Duration()
+
+	monitoringMetadataCacheTTL = kingpin.Flag(
+		"monitoring.metadata-cache-ttl", "How long the Google Stackdriver Monitoring Metric Descriptors of the explicit Metric Types are cached, 0 caches them until the exporter is restarted ($STACKDRIVER_EXPORTER_MONITORING_METADATA_CACHE_TTL).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METADATA_CACHE_TTL").Default("1h").Duration()
+
+	monitoringEmptyDescriptorsCooldown = kingpin.Flag(
+		"monitoring.empty-descriptors-cooldown", "How long not to request the Time Series of a Google Stackdriver Monitoring Metric Descriptor again after it returned none, 0 disables it ($STACKDRIVER_EXPORTER_MONITORING_EMPTY_DESCRIPTORS_COOLDOWN).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_EMPTY_DESCRIPTORS_COOLDOWN").Default("0s").Duration()
+
+	monitoringMetricsTypeInclude = kingpin.Flag(
+		"monitoring.metrics-type-include", "Regular expression the Google Stackdriver Monitoring Metric Types must match to be collected ($STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_INCLUDE).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_INCLUDE").Regexp()
+
+	monitoringMetricsTypeExclude = kingpin.Flag(
+		"monitoring.metrics-type-exclude", "Regular expression of Google Stackdriver Monitoring Metric Types not to collect, takes precedence over the include expression ($STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_EXCLUDE).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRICS_TYPE_EXCLUDE").Regexp()
+
+	monitoringMonitoredResourceTypes = kingpin.Flag(
+		"monitoring.monitored-resource-types", "Comma separated Google Stackdriver Monitoring Monitored Resource Types, Metric Descriptors listed for none of them are not collected ($STACKDRIVER_EXPORTER_MONITORING_MONITORED_RESOURCE_TYPES).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_MONITORED_RESOURCE_TYPES").String()
+
+	monitoringMetricKinds = kingpin.Flag(
+		"monitoring.metric-kinds", "Comma separated Google Stackdriver Monitoring Metric Kinds to collect, among `GAUGE`, `DELTA` and `CUMULATIVE`. Empty means all of them ($STACKDRIVER_EXPORTER_MONITORING_METRIC_KINDS).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_METRIC_KINDS").String()
+
+	monitoringShardIndex = kingpin.Flag(
+		"monitoring.shard-index", "Index, starting at 0, of the shard of Metric Types collected by this exporter replica ($STACKDRIVER_EXPORTER_MONITORING_SHARD_INDEX).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SHARD_INDEX").Default("0").Int()
+
+	monitoringShardTotal = kingpin.Flag(
+		"monitoring.shard-total", "Number of exporter replicas sharing the Metric Types to collect, each collecting the ones hashed to its shard ($STACKDRIVER_EXPORTER_MONITORING_SHARD_TOTAL).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SHARD_TOTAL").Default("1").Int()
+
+	collectorUnitAsSuffix = kingpin.Flag(
+		"collector.unit-as-suffix", "Append the metric unit as a metric name suffix instead of reporting it as the `unit` label, unknown units are still reported as a label ($STACKDRIVER_EXPORTER_COLLECTOR_UNIT_AS_SUFFIX).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_UNIT_AS_SUFFIX").Default("false").Bool()
+
+	monitoringAggregateDeltas = kingpin.Flag(
+		"monitoring.aggregate-deltas", "Aggregate the points of DELTA metrics across scrapes and report them as counters ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATE_DELTAS).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATE_DELTAS").Default("false").Bool()
+
+	monitoringAggregateDeltasTTL = kingpin.Flag(
+		"monitoring.aggregate-deltas-ttl", "How long an aggregated DELTA metric series is kept without being updated ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATE_DELTAS_TTL).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATE_DELTAS_TTL").Default("30m").Duration()
+
+	monitoringAggregateDeltasMaxEntries = kingpin.Flag(
+		"monitoring.aggregate-deltas-max-entries", "Max number of aggregated DELTA metric series kept, evicting the least recently updated ones, 0 means unlimited ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATE_DELTAS_MAX_ENTRIES).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATE_DELTAS_MAX_ENTRIES").Default("0").Int()
+
+	monitoringDeltaPoints = kingpin.Flag(
+		"monitoring.delta-points", "How the points of a DELTA metric within the interval are reported, either the `newest` one or the `sum` of all of them ($STACKDRIVER_EXPORTER_MONITORING_DELTA_POINTS).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_DELTA_POINTS").Default("newest").Enum("newest", "sum")
+
+	monitoringDeltaRates = kingpin.Flag(
+		"monitoring.delta-rates", "Request the INT64 and DOUBLE DELTA metrics aligned as per-second rates over the metrics interval, and report them as `_rate` gauges ($STACKDRIVER_EXPORTER_MONITORING_DELTA_RATES).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_DELTA_RATES").Default("false").Bool()
+
+	collectorMetricsWithTimestamp = kingpin.Flag(
+		"collector.metrics-with-timestamp", "Report metrics with the end time of their Google Stackdriver Monitoring data point as timestamp, disable to let Prometheus use the scrape time ($STACKDRIVER_EXPORTER_COLLECTOR_METRICS_WITH_TIMESTAMP).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_METRICS_WITH_TIMESTAMP").Default("true").Bool()
+
+	monitoringAggregationAlignmentPeriod = kingpin.Flag(
+		"monitoring.aggregation.alignment-period", "Alignment period of the server-side aggregation of Google Stackdriver Monitoring Time Series ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_ALIGNMENT_PERIOD).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_ALIGNMENT_PERIOD").Default("0s").Duration()
+
+	monitoringAggregationPerSeriesAligner = kingpin.Flag(
+		"monitoring.aggregation.per-series-aligner", "Per-series aligner of the server-side aggregation of Google Stackdriver Monitoring Time Series ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_PER_SERIES_ALIGNER).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_PER_SERIES_ALIGNER").Enum(aligners...)
+
+	monitoringAggregationCrossSeriesReducer = kingpin.Flag(
+		"monitoring.aggregation.cross-series-reducer", "Cross-series reducer of the server-side aggregation of Google Stackdriver Monitoring Time Series ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_CROSS_SERIES_REDUCER).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_CROSS_SERIES_REDUCER").Enum(reducers...)
+
+	monitoringAggregationGroupByFields = kingpin.Flag(
+		"monitoring.aggregation.group-by-field", "Field to preserve when reducing Google Stackdriver Monitoring Time Series. Repeatable ($STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_GROUP_BY_FIELD).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_AGGREGATION_GROUP_BY_FIELD").Strings()
+
+	monitoringSecondaryAggregationAlignmentPeriod = kingpin.Flag(
+		"monitoring.secondary-aggregation.alignment-period", "Alignment period of the secondary server-side aggregation of Google Stackdriver Monitoring Time Series, applied to the result of the first one ($STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_ALIGNMENT_PERIOD).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_ALIGNMENT_PERIOD").Default("0s").Duration()
+
+	monitoringSecondaryAggregationPerSeriesAligner = kingpin.Flag(
+		"monitoring.secondary-aggregation.per-series-aligner", "Per-series aligner of the secondary server-side aggregation of Google Stackdriver Monitoring Time Series ($STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_PER_SERIES_ALIGNER).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_PER_SERIES_ALIGNER").Enum(aligners...)
+
+	monitoringSecondaryAggregationCrossSeriesReducer = kingpin.Flag(
+		"monitoring.secondary-aggregation.cross-series-reducer", "Cross-series reducer of the secondary server-side aggregation of Google Stackdriver Monitoring Time Series ($STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_CROSS_SERIES_REDUCER).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_CROSS_SERIES_REDUCER").Enum(reducers...)
+
+	monitoringSecondaryAggregationGroupByFields = kingpin.Flag(
+		"monitoring.secondary-aggregation.group-by-field", "Field to preserve when reducing Google Stackdriver Monitoring Time Series in the secondary aggregation. Repeatable ($STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_GROUP_BY_FIELD).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_SECONDARY_AGGREGATION_GROUP_BY_FIELD").Strings()
+
+	monitoringMetricsFilters = kingpin.Flag(
+		"monitoring.filters", "Filter expression AND-ed to the Google Stackdriver Monitoring Time Series filter of the Metric Types starting with a prefix, as `prefix:filter`. Repeatable ($STACKDRIVER_EXPORTER_MONITORING_FILTERS).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_FILTERS").Strings()
+
+	monitoringResourceTypes = kingpin.Flag(
+		"monitoring.resource-types", "Comma separated Google Stackdriver Monitoring Monitored Resource Types to collect the Metric Types starting with a prefix for, as `prefix:type,type`. Repeatable ($STACKDRIVER_EXPORTER_MONITORING_RESOURCE_TYPES).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_RESOURCE_TYPES").Strings()
+
+	monitoringQueries = kingpin.Flag(
+		"monitoring.query", "Named Google Stackdriver Monitoring Query Language query to run on every scrape, as `name:query`. Repeatable ($STACKDRIVER_EXPORTER_MONITORING_QUERY).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_QUERY").Strings()
+
+	collectorLabelRenames = kingpin.Flag(
+		"collector.label-rename", "Rename a label of the Google Stackdriver Monitoring metrics, as `label:new_label`. Repeatable ($STACKDRIVER_EXPORTER_COLLECTOR_LABEL_RENAME).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_LABEL_RENAME").Strings()
+
+	collectorLabelDrops = kingpin.Flag(
+		"collector.label-drop", "Drop a label of the Google Stackdriver Monitoring metrics. Repeatable ($STACKDRIVER_EXPORTER_COLLECTOR_LABEL_DROP).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_LABEL_DROP").Strings()
+
+	collectorDistributions = kingpin.Flag(
+		"collector.distributions", "How DISTRIBUTION metrics are reported, either as `histogram` or as `mean-count`, cheaper `_mean` and `_count` metrics without buckets ($STACKDRIVER_EXPORTER_COLLECTOR_DISTRIBUTIONS).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_DISTRIBUTIONS").Default("histogram").Enum("histogram", "mean-count")
+
+	collectorNonFiniteValues = kingpin.Flag(
+		"collector.non-finite-values", "How non-finite values of DOUBLE metrics are reported, either `pass` them through, `drop` them, or `clamp` infinities to the largest finite values and drop NaN ($STACKDRIVER_EXPORTER_COLLECTOR_NON_FINITE_VALUES).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_NON_FINITE_VALUES").Default("pass").Enum("pass", "drop", "clamp")
+
+	collectorNegativeCounterValues = kingpin.Flag(
+		"collector.negative-counter-values", "How negative values of metrics reported as counters are reported, either `pass` them through, `drop` them, or `clamp` them to zero ($STACKDRIVER_EXPORTER_COLLECTOR_NEGATIVE_COUNTER_VALUES).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_NEGATIVE_COUNTER_VALUES").Default("pass").Enum("pass", "drop", "clamp")
+
+	collectorStringMetricsAsInfo = kingpin.Flag(
+		"collector.string-metrics-as-info", "Report STRING metrics as `_info` gauges with the string in a `value` label, beware each distinct string creates a new series ($STACKDRIVER_EXPORTER_COLLECTOR_STRING_METRICS_AS_INFO).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_STRING_METRICS_AS_INFO").Default("false").Bool()
+
+	collectorDropUnitLabel = kingpin.Flag(
+		"collector.drop-unit-label", "Do not report the metric unit as the `unit` label ($STACKDRIVER_EXPORTER_COLLECTOR_DROP_UNIT_LABEL).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_DROP_UNIT_LABEL").Default("false").Bool()
+
+	collectorUnitInHelp = kingpin.Flag(
+		"collector.unit-in-help", "Append the metric unit to the metric help instead of reporting it as the `unit` label ($STACKDRIVER_EXPORTER_COLLECTOR_UNIT_IN_HELP).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_UNIT_IN_HELP").Default("false").Bool()
+
+	collectorHelpMaxLength = kingpin.Flag(
+		"collector.help-max-length", "Max number of characters of the metric help taken from the Metric Descriptor description, 0 for no limit ($STACKDRIVER_EXPORTER_COLLECTOR_HELP_MAX_LENGTH).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_HELP_MAX_LENGTH").Default("0").Int()
+
+	collectorHelpStripNewlines = kingpin.Flag(
+		"collector.help-strip-newlines", "Replace the newlines of multi-paragraph Metric Descriptor descriptions with spaces in the metric help ($STACKDRIVER_EXPORTER_COLLECTOR_HELP_STRIP_NEWLINES).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_HELP_STRIP_NEWLINES").Default("false").Bool()
+
+	collectorResourceTypeLabel = kingpin.Flag(
+		"collector.resource-type-label", "Report the Google Stackdriver Monitoring Monitored Resource Type as the `resource_type` label ($STACKDRIVER_EXPORTER_COLLECTOR_RESOURCE_TYPE_LABEL).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_RESOURCE_TYPE_LABEL").Default("false").Bool()
+
+	collectorResourceTypeNames = kingpin.Flag(
+		"collector.resource-type-names", "Name to report in the `resource_type` label for a Google Stackdriver Monitoring Monitored Resource Type, as `type:name`. Repeatable ($STACKDRIVER_EXPORTER_COLLECTOR_RESOURCE_TYPE_NAMES).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_RESOURCE_TYPE_NAMES").Strings()
+
+	collectorNamespaceOverrides = kingpin.Flag(
+		"collector.namespace-override", "Namespace, and optionally subsystem, of the metrics of the Google Stackdriver Monitoring Metric Types starting with a prefix, as `prefix:namespace[:subsystem]`. The prefix is trimmed from their names. Repeatable ($STACKDRIVER_EXPORTER_COLLECTOR_NAMESPACE_OVERRIDE).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_NAMESPACE_OVERRIDE").Strings()
+
+	collectorCounterTotalSuffix = kingpin.Flag(
+		"collector.counter-total-suffix", "Append `_total` to the name of the metrics reported as counters, as the Prometheus naming conventions require ($STACKDRIVER_EXPORTER_COLLECTOR_COUNTER_TOTAL_SUFFIX).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_COUNTER_TOTAL_SUFFIX").Default("false").Bool()
+
+	collectorMetricTypeLabel = kingpin.Flag(
+		"collector.metric-type-label", "Report the original Google Stackdriver Monitoring Metric Type as the `stackdriver_metric_type` label. It maps one to one to the metric name, so it only adds series when different Metric Types normalize to the same name ($STACKDRIVER_EXPORTER_COLLECTOR_METRIC_TYPE_LABEL).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_METRIC_TYPE_LABEL").Default("false").Bool()
+
+	collectorRegionLabelSources = kingpin.Flag(
+		"collector.region-label-sources", "Comma separated monitored resource labels to derive a `region` label from, in order of preference (ie `zone,location`). Zones are turned into their region ($STACKDRIVER_EXPORTER_COLLECTOR_REGION_LABEL_SOURCES).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_REGION_LABEL_SOURCES").String()
+
+	collectorMetadataLabels = kingpin.Flag(
+		"collector.metadata-labels", "Label of the monitored resource metadata of the Time Series to report, as `system_labels.<key>` or `user_labels.<key>` (ie `system_labels.machine_type`), reported with a `metadata_system_` or `metadata_user_` prefix. Requires a cross-series reducer. Repeatable ($STACKDRIVER_EXPORTER_COLLECTOR_METADATA_LABELS).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_METADATA_LABELS").Strings()
+
+	collectorDescriptorMetadata = kingpin.Flag(
+		"collector.descriptor-metadata", "Report the launch stage of Google Stackdriver Monitoring metrics as the `launch_stage` label, and their ingest delay and sample period as separate metrics ($STACKDRIVER_EXPORTER_COLLECTOR_DESCRIPTOR_METADATA).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_DESCRIPTOR_METADATA").Default("false").Bool()
+
+	collectorMetricInfo = kingpin.Flag(
+		"collector.metric-info", "Report a `metric_info` gauge per Google Stackdriver Monitoring Metric Type carrying its unit, value type, metric kind and launch stage as labels ($STACKDRIVER_EXPORTER_COLLECTOR_METRIC_INFO).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_METRIC_INFO").Default("false").Bool()
+
+	monitoringMaxSeriesPerMetricType = kingpin.Flag(
+		"monitoring.max-series-per-metric-type", "Max number of Google Stackdriver Monitoring Time Series to report per Metric Type on each scrape, 0 means unlimited ($STACKDRIVER_EXPORTER_MONITORING_MAX_SERIES_PER_METRIC_TYPE).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_MAX_SERIES_PER_METRIC_TYPE").Default("0").Int()
+
+	monitoringPageSize = kingpin.Flag(
+		"monitoring.page-size", "Max number of results per page of the Google Stackdriver Monitoring API list calls, up to 100000. 0 means the API default ($STACKDRIVER_EXPORTER_MONITORING_PAGE_SIZE).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_PAGE_SIZE").Default("0").Int64()
+
+	monitoringDescriptorsBatchSize = kingpin.Flag(
+		"monitoring.descriptors-batch-size", "Max number of Google Stackdriver Monitoring Metric Types to request with a single Time Series filter, up to 100. 1 requests each Metric Type on its own ($STACKDRIVER_EXPORTER_MONITORING_DESCRIPTORS_BATCH_SIZE).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_DESCRIPTORS_BATCH_SIZE").Default("1").Int()
+
+	monitoringTimeSeriesView = kingpin.Flag(
+		"monitoring.time-series-view", "View of the Google Stackdriver Monitoring Time Series to request, `HEADERS` only reports the presence of each series as a `_present` gauge ($STACKDRIVER_EXPORTER_MONITORING_TIME_SERIES_VIEW).",
+	).Envar("STACKDRIVER_EXPORTER_MONITORING_TIME_SERIES_VIEW").Default("FULL").Enum("FULL", "HEADERS")
+
+	collectorBestEffort = kingpin.Flag(
+		"collector.best-effort", "Keep scraping the remaining Google Stackdriver Monitoring metrics of a prefix when some of them fail, and report all the errors at the end of the scrape ($STACKDRIVER_EXPORTER_COLLECTOR_BEST_EFFORT).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_BEST_EFFORT").Default("false").Bool()
 )
 
+// maxPageSize is the max page size of the Google Stackdriver Monitoring API.
+// @see https://cloud.google.com/monitoring/api/ref_v3/rest/v3/projects.timeSeries/list
+const maxPageSize = 100000
+
+// maxDescriptorsBatchSize is the max number of Metric Types requested with a
+// single Time Series filter.
+const maxDescriptorsBatchSize = 100
+
+// maxFilterLength is the max length of a batched Time Series filter, to keep
+// it within the limits of the Google Stackdriver Monitoring API.
+const maxFilterLength = 2048
+
 type MonitoringCollector struct {
-	projectID                       string
-	metricsTypePrefixes             []string
-	metricsInterval                 time.Duration
-	metricsOffset                   time.Duration
-	monitoringService               *monitoring.Service
-	apiCallsTotalMetric             prometheus.Counter
-	scrapesTotalMetric              prometheus.Counter
-	scrapeErrorsTotalMetric         prometheus.Counter
-	lastScrapeErrorMetric           prometheus.Gauge
-	lastScrapeTimestampMetric       prometheus.Gauge
-	lastScrapeDurationSecondsMetric prometheus.Gauge
-	collectorFillMissingLabels      bool
-	monitoringDropDelegatedProjects bool
-	logger                          log.Logger
-}
-
-func NewMonitoringCollector(projectID string, monitoringService *monitoring.Service, filters map[string]bool, logger log.Logger) (*MonitoringCollector, error) {
-	if *monitoringMetricsTypePrefixes == "" {
-		return nil, errors.New("Flag `monitoring.metrics-type-prefixes` is required")
+	projectID                         string
+	descriptorsProjectID              string
+	namespace                         string
+	subsystem                         string
+	metricsTypePrefixes               []string
+	metricsTypes                      []string
+	metricsInterval                   time.Duration
+	metricsIntervalOverrides          map[string]time.Duration
+	metricsOffset                     time.Duration
+	lookbackMultiplier                float64
+	fixedIntervalStart                time.Time
+	fixedIntervalEnd                  time.Time
+	monitoringService                 *monitoring.Service
+	apiCallsTotalMetric               prometheus.Counter
+	apiCallDurationSecondsMetric      *prometheus.HistogramVec
+	requestWaitSecondsMetric          prometheus.Histogram
+	scrapesTotalMetric                prometheus.Counter
+	scrapeErrorsTotalMetric           *prometheus.CounterVec
+	lastScrapeErrorMetric             prometheus.Gauge
+	upMetric                          prometheus.Gauge
+	lastScrapeTimestampMetric         prometheus.Gauge
+	lastScrapeDurationSecondsMetric   prometheus.Gauge
+	descriptorCacheHitsTotalMetric    prometheus.Counter
+	descriptorCacheMissesTotalMetric  prometheus.Counter
+	metadataCacheHitsTotalMetric      prometheus.Counter
+	metadataCacheMissesTotalMetric    prometheus.Counter
+	timeSeriesTotalMetric             *prometheus.CounterVec
+	seriesDroppedTotalMetric          *prometheus.CounterVec
+	negativeCounterValuesTotalMetric  *prometheus.CounterVec
+	partialScrapesTotalMetric         prometheus.Counter
+	emptyDescriptorsTotalMetric       *prometheus.CounterVec
+	pointAgeSecondsMetric             *prometheus.GaugeVec
+	queryWindowStartSecondsMetric     *prometheus.GaugeVec
+	queryWindowEndSecondsMetric       *prometheus.GaugeVec
+	prefixScrapeDurationSecondsMetric *prometheus.GaugeVec
+	prefixPermissionErrorsTotalMetric *prometheus.CounterVec
+	metricDescriptorsMetric           *prometheus.GaugeVec
+	metricIngestDelayDesc             *prometheus.Desc
+	metricSamplePeriodDesc            *prometheus.Desc
+	metricInfoDesc                    *prometheus.Desc
+	accumulatorEntriesDesc            *prometheus.Desc
+	accumulatorEvictionsTotalDesc     *prometheus.Desc
+	metadataCacheEntriesDesc          *prometheus.Desc
+	configIntervalDesc                *prometheus.Desc
+	configIntervalOverrideDesc        *prometheus.Desc
+	configOffsetDesc                  *prometheus.Desc
+	configRequestTimeoutDesc          *prometheus.Desc
+	collectorFillMissingLabels        bool
+	collectorDropEmptyLabels          bool
+	collectorUnitAsSuffix             bool
+	collectorMetricsWithTimestamp     bool
+	collectorStringMetricsAsInfo      bool
+	collectorDistributions            string
+	collectorNonFiniteValues          string
+	collectorNegativeCounterValues    string
+	collectorDropUnitLabel            bool
+	collectorUnitInHelp               bool
+	collectorHelpMaxLength            int
+	collectorHelpStripNewlines        bool
+	collectorCounterTotalSuffix       bool
+	collectorMetricTypeLabel          bool
+	collectorResourceTypeLabel        bool
+	resourceTypeNames                 map[string]string
+	namespaceOverrides                map[string]*namespaceOverride
+	collectorRegionLabelSources       []string
+	collectorMetadataLabels           []string
+	collectorDescriptorMetadata       bool
+	collectorMetricInfo               bool
+	collectorBestEffort               bool
+	monitoringDropDelegatedProjects   bool
+	requestTimeout                    time.Duration
+	scrapeTimeout                     time.Duration
+	workers                           *workerPool
+	prefixWorkers                     *workerPool
+	prefixJitter                      time.Duration
+	maxDescriptorsPerPrefix           int
+	maxSeriesPerMetricType            int
+	descriptorCache                   *descriptorCache
+	typeDescriptorCache               *descriptorCache
+	emptyDescriptors                  *descriptorCache
+	metricsTypeInclude                *regexp.Regexp
+	metricsTypeExclude                *regexp.Regexp
+	monitoredResourceTypes            map[string]bool
+	metricKinds                       map[string]bool
+	shardIndex                        int
+	shardTotal                        int
+	deltaCounters                     *deltaCounterStore
+	newestPointsLock                  sync.Mutex
+	newestPoints                      map[string]time.Time
+	permissionErrorsLock              sync.Mutex
+	permissionErrorsLogged            map[string]time.Time
+	deltaPoints                       string
+	deltaRates                        bool
+	timeSeriesView                    string
+	pageSize                          int64
+	descriptorsBatchSize              int
+	aggregation                       aggregation
+	metricsFilters                    map[string]string
+	resourceTypes                     map[string][]string
+	queries                           map[string]string
+	labelRules                        *labelRules
+	metricTransformers                []MetricTransformer
+	otlpRecorder                      *otlpRecorder
+	filterBuilder                     FilterBuilder
+	extraLabels                       prometheus.Labels
+	logger                            log.Logger
+}
+
+// selfMetricLabelNames are the label names of the collector metrics, which the
+// extra const labels must not collide with.
+var selfMetricLabelNames = map[string]bool{
+	"project_id":         true,
+	"scope":              true,
+	"method":             true,
+	"reason":             true,
+	"metric_type":        true,
+	"metric_type_prefix": true,
+	"unit":               true,
+	"value_type":         true,
+	"metric_kind":        true,
+	"launch_stage":       true,
+}
+
+// MonitoringCollectorOptions holds the settings of the collectors. They are
+// set by the flags, and the Metric Types to collect along with their options
+// can be overridden by a config file.
+type MonitoringCollectorOptions struct {
+	MetricsTypePrefixes                    []string
+	MetricsTypes                           []string
+	MetricsInterval                        time.Duration
+	MetricsIntervalOverrides               map[string]time.Duration
+	MetricsOffset                          time.Duration
+	MonitoredResourceTypes                 []string
+	MetricsFilters                         map[string]string
+	ResourceTypes                          map[string][]string
+	Namespace                              string
+	Subsystem                              string
+	DescriptorsProjectID                   string
+	LookbackMultiplier                     float64
+	IntervalStart                          string
+	IntervalEnd                            string
+	FillMissingLabels                      bool
+	DropEmptyLabels                        bool
+	DropDelegatedProjects                  bool
+	RequestTimeout                         time.Duration
+	ScrapeTimeout                          time.Duration
+	MaxConcurrentRequests                  int
+	MaxConcurrentPrefixes                  int
+	PrefixJitter                           time.Duration
+	MaxDescriptorsPerPrefix                int
+	DescriptorCacheTTL                     time.Duration
+	MetadataCacheTTL                       time.Duration
+	EmptyDescriptorsCooldown               time.Duration
+	MetricsTypeInclude                     *regexp.Regexp
+	MetricsTypeExclude                     *regexp.Regexp
+	MetricKinds                            string
+	ShardIndex                             int
+	ShardTotal                             int
+	UnitAsSuffix                           bool
+	AggregateDeltas                        bool
+	AggregateDeltasTTL                     time.Duration
+	AggregateDeltasMaxEntries              int
+	DeltaPoints                            string
+	DeltaRates                             bool
+	MetricsWithTimestamp                   bool
+	AggregationAlignmentPeriod             time.Duration
+	AggregationPerSeriesAligner            string
+	AggregationCrossSeriesReducer          string
+	AggregationGroupByFields               []string
+	SecondaryAggregationAlignmentPeriod    time.Duration
+	SecondaryAggregationPerSeriesAligner   string
+	SecondaryAggregationCrossSeriesReducer string
+	SecondaryAggregationGroupByFields      []string
+	Queries                                []string
+	LabelRenames                           []string
+	LabelDrops                             []string
+	Distributions                          string
+	NonFiniteValues                        string
+	NegativeCounterValues                  string
+	StringMetricsAsInfo                    bool
+	DropUnitLabel                          bool
+	UnitInHelp                             bool
+	HelpMaxLength                          int
+	HelpStripNewlines                      bool
+	ResourceTypeLabel                      bool
+	ResourceTypeNames                      []string
+	NamespaceOverrides                     []string
+	CounterTotalSuffix                     bool
+	MetricTypeLabel                        bool
+	RegionLabelSources                     string
+	MetadataLabels                         []string
+	DescriptorMetadata                     bool
+	MetricInfo                             bool
+	MaxSeriesPerMetricType                 int
+	PageSize                               int64
+	DescriptorsBatchSize                   int
+	TimeSeriesView                         string
+	BestEffort                             bool
+}
+
+// NewMonitoringCollectorOptions returns the options set by the flags.
+func NewMonitoringCollectorOptions() (*MonitoringCollectorOptions, error) {
+	options := &MonitoringCollectorOptions{
+		MetricsInterval:                        *monitoringMetricsInterval,
+		MetricsIntervalOverrides:               make(map[string]time.Duration),
+		MetricsOffset:                          *monitoringMetricsOffset,
+		ResourceTypes:                          make(map[string][]string),
+		Namespace:                              *collectorNamespace,
+		Subsystem:                              *collectorSubsystem,
+		DescriptorsProjectID:                   *monitoringDescriptorsProjectID,
+		LookbackMultiplier:                     *monitoringLookbackMultiplier,
+		IntervalStart:                          *monitoringIntervalStart,
+		IntervalEnd:                            *monitoringIntervalEnd,
+		FillMissingLabels:                      *collectorFillMissingLabels,
+		DropEmptyLabels:                        *collectorDropEmptyLabels,
+		DropDelegatedProjects:                  *monitoringDropDelegatedProjects,
+		RequestTimeout:                         *monitoringRequestTimeout,
+		ScrapeTimeout:                          *monitoringScrapeTimeout,
+		MaxConcurrentRequests:                  *monitoringMaxConcurrentRequests,
+		MaxConcurrentPrefixes:                  *monitoringMaxConcurrentPrefixes,
+		PrefixJitter:                           *monitoringPrefixJitter,
+		MaxDescriptorsPerPrefix:                *monitoringMaxDescriptorsPerPrefix,
+		DescriptorCacheTTL:                     *monitoringDescriptorCacheTTL,
+		MetadataCacheTTL:                       *monitoringMetadataCacheTTL,
+		EmptyDescriptorsCooldown:               *monitoringEmptyDescriptorsCooldown,
+		MetricsTypeInclude:                     *monitoringMetricsTypeInclude,
+		MetricsTypeExclude:                     *monitoringMetricsTypeExclude,
+		MetricKinds:                            *monitoringMetricKinds,
+		ShardIndex:                             *monitoringShardIndex,
+		ShardTotal:                             *monitoringShardTotal,
+		UnitAsSuffix:                           *collectorUnitAsSuffix,
+		AggregateDeltas:                        *monitoringAggregateDeltas,
+		AggregateDeltasTTL:                     *monitoringAggregateDeltasTTL,
+		AggregateDeltasMaxEntries:              *monitoringAggregateDeltasMaxEntries,
+		DeltaPoints:                            *monitoringDeltaPoints,
+		DeltaRates:                             *monitoringDeltaRates,
+		MetricsWithTimestamp:                   *collectorMetricsWithTimestamp,
+		AggregationAlignmentPeriod:             *monitoringAggregationAlignmentPeriod,
+		AggregationPerSeriesAligner:            *monitoringAggregationPerSeriesAligner,
+		AggregationCrossSeriesReducer:          *monitoringAggregationCrossSeriesReducer,
+		AggregationGroupByFields:               *monitoringAggregationGroupByFields,
+		SecondaryAggregationAlignmentPeriod:    *monitoringSecondaryAggregationAlignmentPeriod,
+		SecondaryAggregationPerSeriesAligner:   *monitoringSecondaryAggregationPerSeriesAligner,
+		SecondaryAggregationCrossSeriesReducer: *monitoringSecondaryAggregationCrossSeriesReducer,
+		SecondaryAggregationGroupByFields:      *monitoringSecondaryAggregationGroupByFields,
+		Queries:                                *monitoringQueries,
+		LabelRenames:                           *collectorLabelRenames,
+		LabelDrops:                             *collectorLabelDrops,
+		Distributions:                          *collectorDistributions,
+		NonFiniteValues:                        *collectorNonFiniteValues,
+		NegativeCounterValues:                  *collectorNegativeCounterValues,
+		StringMetricsAsInfo:                    *collectorStringMetricsAsInfo,
+		DropUnitLabel:                          *collectorDropUnitLabel,
+		UnitInHelp:                             *collectorUnitInHelp,
+		HelpMaxLength:                          *collectorHelpMaxLength,
+		HelpStripNewlines:                      *collectorHelpStripNewlines,
+		ResourceTypeLabel:                      *collectorResourceTypeLabel,
+		ResourceTypeNames:                      *collectorResourceTypeNames,
+		NamespaceOverrides:                     *collectorNamespaceOverrides,
+		CounterTotalSuffix:                     *collectorCounterTotalSuffix,
+		MetricTypeLabel:                        *collectorMetricTypeLabel,
+		RegionLabelSources:                     *collectorRegionLabelSources,
+		MetadataLabels:                         *collectorMetadataLabels,
+		DescriptorMetadata:                     *collectorDescriptorMetadata,
+		MetricInfo:                             *collectorMetricInfo,
+		MaxSeriesPerMetricType:                 *monitoringMaxSeriesPerMetricType,
+		PageSize:                               *monitoringPageSize,
+		DescriptorsBatchSize:                   *monitoringDescriptorsBatchSize,
+		TimeSeriesView:                         *monitoringTimeSeriesView,
+		BestEffort:                             *collectorBestEffort,
+	}
+	if *monitoringMetricsTypePrefixes != "" {
+		options.MetricsTypePrefixes = strings.Split(*monitoringMetricsTypePrefixes, ",")
+	}
+	if *monitoringMetricsTypes != "" {
+		options.MetricsTypes = strings.Split(*monitoringMetricsTypes, ",")
+	}
+	if *monitoringMonitoredResourceTypes != "" {
+		options.MonitoredResourceTypes = strings.Split(*monitoringMonitoredResourceTypes, ",")
+	}
+
+	intervalOverrides, err := utils.ParsePrefixMap(*monitoringMetricsIntervalOverrides)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `monitoring.metrics-interval-override` is invalid: %v", err)
+	}
+	for prefix, interval := range intervalOverrides {
+		options.MetricsIntervalOverrides[prefix], err = time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("Flag `monitoring.metrics-interval-override` is invalid for prefix %q: %v", prefix, err)
+		}
+	}
+
+	options.MetricsFilters, err = utils.ParsePrefixMap(*monitoringMetricsFilters)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `monitoring.filters` is invalid: %v", err)
+	}
+
+	prefixResourceTypes, err := utils.ParsePrefixMap(*monitoringResourceTypes)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `monitoring.resource-types` is invalid: %v", err)
+	}
+	for prefix, types := range prefixResourceTypes {
+		if types == "" {
+			return nil, fmt.Errorf("Flag `monitoring.resource-types` is invalid for prefix %q: no resource types", prefix)
+		}
+		options.ResourceTypes[prefix] = strings.Split(types, ",")
+	}
+
+	return options, nil
+}
+
+// NewMonitoringCollector returns a collector for a project, organization or
+// folder. The extra const labels are added to every metric it exports.
+func NewMonitoringCollector(projectID string, monitoringService *monitoring.Service, options *MonitoringCollectorOptions, extraLabels prometheus.Labels, logger log.Logger) (*MonitoringCollector, error) {
+	if len(options.MetricsTypePrefixes) == 0 && len(options.MetricsTypes) == 0 {
+		return nil, errors.New("Flag `monitoring.metrics-type-prefixes` or `monitoring.metrics-types` is required")
+	}
+
+	// Several collectors share the logger when scraping multiple projects
+	logger = log.With(logger, "project_id", projectID)
+
+	namespace := options.Namespace
+	subsystem := options.Subsystem
+
+	// Organizations and folders have no metric descriptors of their own, so
+	// they are listed from a project
+	constLabels := prometheus.Labels{"project_id": projectID}
+	descriptorsProjectID := projectID
+	if !utils.IsProjectScope(projectID) {
+		if options.DescriptorsProjectID == "" {
+			return nil, fmt.Errorf("Flag `monitoring.descriptors-project-id` is required to collect %s", projectID)
+		}
+		if options.DropDelegatedProjects {
+			return nil, fmt.Errorf("Flag `monitoring.drop-delegated-projects` can not be used to collect %s", projectID)
+		}
+		constLabels = prometheus.Labels{"scope": projectID}
+		descriptorsProjectID = options.DescriptorsProjectID
+	}
+	for name, value := range extraLabels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return nil, fmt.Errorf("Const label %q is not a valid label name", name)
+		}
+		if selfMetricLabelNames[name] {
+			return nil, fmt.Errorf("Const label %q collides with a label of the collector metrics", name)
+		}
+		constLabels[name] = value
 	}
 
 	apiCallsTotalMetric := prometheus.NewCounter(
 		prometheus.CounterOpts{
-			Namespace:   "stackdriver",
-			Subsystem:   "monitoring",
+			Namespace:   namespace,
+			Subsystem:   subsystem,
 			Name:        "api_calls_total",
 			Help:        "Total number of Google Stackdriver Monitoring API calls made.",
-			ConstLabels: prometheus.Labels{"project_id": projectID},
+			ConstLabels: constLabels,
+		},
+	)
+
+	apiCallDurationSecondsMetric := prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "api_call_duration_seconds",
+			Help:        "Duration in seconds of the Google Stackdriver Monitoring API calls made.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+
+	requestWaitSecondsMetric := prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "request_wait_seconds",
+			Help:        "Time in seconds spent waiting for a free worker before making Google Stackdriver Monitoring API calls.",
+			ConstLabels: constLabels,
+			Buckets:     prometheus.DefBuckets,
 		},
 	)
 
 	scrapesTotalMetric := prometheus.NewCounter(
 		prometheus.CounterOpts{
-			Namespace:   "stackdriver",
-			Subsystem:   "monitoring",
+			Namespace:   namespace,
+			Subsystem:   subsystem,
 			Name:        "scrapes_total",
 			Help:        "Total number of Google Stackdriver Monitoring metrics scrapes.",
-			ConstLabels: prometheus.Labels{"project_id": projectID},
+			ConstLabels: constLabels,
 		},
 	)
 
-	scrapeErrorsTotalMetric := prometheus.NewCounter(
+	scrapeErrorsTotalMetric := prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Namespace:   "stackdriver",
-			Subsystem:   "monitoring",
+			Namespace:   namespace,
+			Subsystem:   subsystem,
 			Name:        "scrape_errors_total",
-			Help:        "Total number of Google Stackdriver Monitoring metrics scrape errors.",
-			ConstLabels: prometheus.Labels{"project_id": projectID},
+			Help:        "Total number of Google Stackdriver Monitoring metrics scrape errors, by reason.",
+			ConstLabels: constLabels,
 		},
+		[]string{"reason"},
 	)
+	for _, reason := range errorReasons {
+		scrapeErrorsTotalMetric.WithLabelValues(reason)
+	}
 
 	lastScrapeErrorMetric := prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Namespace:   "stackdriver",
-			Subsystem:   "monitoring",
+			Namespace:   namespace,
+			Subsystem:   subsystem,
 			Name:        "last_scrape_error",
 			Help:        "Whether the last metrics scrape from Google Stackdriver Monitoring resulted in an error (1 for error, 0 for success).",
-			ConstLabels: prometheus.Labels{"project_id": projectID},
+			ConstLabels: constLabels,
+		},
+	)
+
+	upMetric := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "up",
+			Help:        "Whether Google Stackdriver Monitoring could be reached on the last metrics scrape, ie listing the Metric Descriptors of at least one prefix succeeded (1 for reached, 0 for unreachable).",
+			ConstLabels: constLabels,
 		},
 	)
 
 	lastScrapeTimestampMetric := prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Namespace:   "stackdriver",
-			Subsystem:   "monitoring",
+			Namespace:   namespace,
+			Subsystem:   subsystem,
 			Name:        "last_scrape_timestamp",
 			Help:        "Number of seconds since 1970 since last metrics scrape from Google Stackdriver Monitoring.",
-			ConstLabels: prometheus.Labels{"project_id": projectID},
+			ConstLabels: constLabels,
 		},
 	)
 
 	lastScrapeDurationSecondsMetric := prometheus.NewGauge(
 		prometheus.GaugeOpts{
-			Namespace:   "stackdriver",
-			Subsystem:   "monitoring",
+			Namespace:   namespace,
+			Subsystem:   subsystem,
 			Name:        "last_scrape_duration_seconds",
 			Help:        "Duration of the last metrics scrape from Google Stackdriver Monitoring.",
-			ConstLabels: prometheus.Labels{"project_id": projectID},
+			ConstLabels: constLabels,
 		},
 	)
 
-	metricsTypePrefixes := strings.Split(*monitoringMetricsTypePrefixes, ",")
-	filteredPrefixes := metricsTypePrefixes
-	if len(filters) > 0 {
-		filteredPrefixes = nil
-		for _, prefix := range metricsTypePrefixes {
-			if filters[prefix] {
-				filteredPrefixes = append(filteredPrefixes, prefix)
+	descriptorCacheHitsTotalMetric := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "descriptor_cache_hits_total",
+			Help:        "Total number of Google Stackdriver Monitoring Metric Descriptors listings served from the cache.",
+			ConstLabels: constLabels,
+		},
+	)
+
+	descriptorCacheMissesTotalMetric := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "descriptor_cache_misses_total",
+			Help:        "Total number of Google Stackdriver Monitoring Metric Descriptors listings not found in the cache.",
+			ConstLabels: constLabels,
+		},
+	)
+
+	metadataCacheHitsTotalMetric := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "metadata_cache_hits_total",
+			Help:        "Total number of Google Stackdriver Monitoring Metric Descriptors of explicit Metric Types served from the cache.",
+			ConstLabels: constLabels,
+		},
+	)
+
+	metadataCacheMissesTotalMetric := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "metadata_cache_misses_total",
+			Help:        "Total number of Google Stackdriver Monitoring Metric Descriptors of explicit Metric Types fetched from the API.",
+			ConstLabels: constLabels,
+		},
+	)
+
+	if err := validateMetadataLabels(options.MetadataLabels); err != nil {
+		return nil, fmt.Errorf("Flag `collector.metadata-labels` is invalid: %v", err)
+	}
+
+	timeSeriesAggregation, err := withMetadataGroupByFields(aggregation{
+		alignmentPeriod:    options.AggregationAlignmentPeriod,
+		perSeriesAligner:   options.AggregationPerSeriesAligner,
+		crossSeriesReducer: options.AggregationCrossSeriesReducer,
+		groupByFields:      options.AggregationGroupByFields,
+	}, options.MetadataLabels)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `collector.metadata-labels` is invalid: %v", err)
+	}
+	secondaryAggregation := aggregation{
+		alignmentPeriod:    options.SecondaryAggregationAlignmentPeriod,
+		perSeriesAligner:   options.SecondaryAggregationPerSeriesAligner,
+		crossSeriesReducer: options.SecondaryAggregationCrossSeriesReducer,
+		groupByFields:      options.SecondaryAggregationGroupByFields,
+	}
+	if secondaryAggregation.configured() {
+		timeSeriesAggregation.secondary = &secondaryAggregation
+	}
+	if err := timeSeriesAggregation.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid `monitoring.aggregation` flags: %v", err)
+	}
+
+	resourceTypeNames, err := utils.ParsePrefixMap(options.ResourceTypeNames)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `collector.resource-type-names` is invalid: %v", err)
+	}
+
+	namespaceOverrides, err := parseNamespaceOverrides(options.NamespaceOverrides)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `collector.namespace-override` is invalid: %v", err)
+	}
+
+	for prefix, filter := range options.MetricsFilters {
+		if strings.Contains(filter, "metric.type") {
+			return nil, fmt.Errorf("Flag `monitoring.filters` is invalid for prefix %q: filters must not contain a `metric.type` clause", prefix)
+		}
+	}
+
+	var fixedIntervalStart, fixedIntervalEnd time.Time
+	if options.IntervalStart != "" || options.IntervalEnd != "" {
+		if options.IntervalStart == "" || options.IntervalEnd == "" {
+			return nil, errors.New("Flags `monitoring.interval-start` and `monitoring.interval-end` must be set together")
+		}
+		if fixedIntervalStart, err = time.Parse(time.RFC3339Nano, options.IntervalStart); err != nil {
+			return nil, fmt.Errorf("Flag `monitoring.interval-start` is invalid: %v", err)
+		}
+		if fixedIntervalEnd, err = time.Parse(time.RFC3339Nano, options.IntervalEnd); err != nil {
+			return nil, fmt.Errorf("Flag `monitoring.interval-end` is invalid: %v", err)
+		}
+		if !fixedIntervalStart.Before(fixedIntervalEnd) {
+			return nil, errors.New("Flag `monitoring.interval-start` must be before `monitoring.interval-end`")
+		}
+	}
+
+	if options.LookbackMultiplier < 1 {
+		return nil, errors.New("Flag `monitoring.lookback-multiplier` must be at least 1")
+	}
+
+	if options.PageSize < 0 || options.PageSize > maxPageSize {
+		return nil, fmt.Errorf("Flag `monitoring.page-size` must be between 0 and %d", maxPageSize)
+	}
+
+	if options.DescriptorsBatchSize < 1 || options.DescriptorsBatchSize > maxDescriptorsBatchSize {
+		return nil, fmt.Errorf("Flag `monitoring.descriptors-batch-size` must be between 1 and %d", maxDescriptorsBatchSize)
+	}
+
+	queries, err := utils.ParsePrefixMap(options.Queries)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `monitoring.query` is invalid: %v", err)
+	}
+
+	labelRules, err := newLabelRules(options.LabelRenames, options.LabelDrops)
+	if err != nil {
+		return nil, fmt.Errorf("Flags `collector.label-rename` and `collector.label-drop` are invalid: %v", err)
+	}
+
+	timeSeriesTotalMetric := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "time_series_total",
+			Help:        "Total number of Google Stackdriver Monitoring Time Series retrieved.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	seriesDroppedTotalMetric := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "series_dropped_total",
+			Help:        "Total number of Google Stackdriver Monitoring Time Series not reported for exceeding the max number of series per Metric Type.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	negativeCounterValuesTotalMetric := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "negative_counter_values_total",
+			Help:        "Total number of negative Google Stackdriver Monitoring Time Series values reported as counters, ie DELTA points accumulated out of order.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	queryWindowStartSecondsMetric := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "query_window_start_seconds",
+			Help:        "Start of the interval of the last Google Stackdriver Monitoring Time Series request for a Metric Type, in unix time.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	queryWindowEndSecondsMetric := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "query_window_end_seconds",
+			Help:        "End of the interval of the last Google Stackdriver Monitoring Time Series request for a Metric Type, in unix time.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	pointAgeSecondsMetric := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "point_age_seconds",
+			Help:        "Age in seconds of the newest Google Stackdriver Monitoring Time Series point retrieved for a Metric Type.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	emptyDescriptorsTotalMetric := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "empty_descriptors_total",
+			Help:        "Total number of Google Stackdriver Monitoring Time Series listings returning no Time Series for a Metric Type.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type"},
+	)
+
+	partialScrapesTotalMetric := prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "partial_scrapes_total",
+			Help:        "Total number of Google Stackdriver Monitoring Time Series listings failing after some of their pages were reported.",
+			ConstLabels: constLabels,
+		},
+	)
+
+	prefixPermissionErrorsTotalMetric := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "prefix_permission_errors_total",
+			Help:        "Total number of Google Stackdriver Monitoring Metric Descriptors listings denied for a Metric Type prefix.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type_prefix"},
+	)
+
+	metricDescriptorsMetric := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "metric_descriptors",
+			Help:        "Number of Google Stackdriver Monitoring Metric Descriptors listed for a Metric Type prefix on the last scrape.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type_prefix"},
+	)
+
+	prefixScrapeDurationSecondsMetric := prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "prefix_scrape_duration_seconds",
+			Help:        "Duration of the last metrics scrape from Google Stackdriver Monitoring for a Metric Type prefix.",
+			ConstLabels: constLabels,
+		},
+		[]string{"metric_type_prefix"},
+	)
+
+	metricIngestDelayDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "metric_ingest_delay_seconds"),
+		"Delay before data points of a Google Stackdriver Monitoring metric are available, from its descriptor metadata.",
+		[]string{"metric_type"},
+		constLabels,
+	)
+
+	metricSamplePeriodDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "metric_sample_period_seconds"),
+		"Sampling period of a Google Stackdriver Monitoring metric, from its descriptor metadata.",
+		[]string{"metric_type"},
+		constLabels,
+	)
+
+	metricInfoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "metric_info"),
+		"Properties of a Google Stackdriver Monitoring metric, from its descriptor.",
+		[]string{"metric_type", "unit", "value_type", "metric_kind", "launch_stage"},
+		constLabels,
+	)
+
+	accumulatorEntriesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "accumulator_entries"),
+		"Number of aggregated DELTA metric series kept in memory.",
+		nil,
+		constLabels,
+	)
+
+	accumulatorEvictionsTotalDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "accumulator_evictions_total"),
+		"Total number of aggregated DELTA metric series evicted to stay within the max number of entries.",
+		nil,
+		constLabels,
+	)
+
+	metadataCacheEntriesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "metadata_cache_entries"),
+		"Number of Google Stackdriver Monitoring Metric Descriptors of explicit Metric Types kept in the cache.",
+		nil,
+		constLabels,
+	)
+
+	configIntervalDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "config_interval_seconds"),
+		"Interval in seconds the Google Stackdriver Monitoring Metrics are requested for.",
+		nil,
+		constLabels,
+	)
+
+	configIntervalOverrideDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "config_interval_override_seconds"),
+		"Interval in seconds the Google Stackdriver Monitoring Metrics starting with a prefix are requested for, overriding the global interval.",
+		[]string{"metric_type_prefix"},
+		constLabels,
+	)
+
+	configOffsetDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "config_offset_seconds"),
+		"Offset in seconds into the past of the Google Stackdriver Monitoring Metrics interval, leaving time for the points to be ingested.",
+		nil,
+		constLabels,
+	)
+
+	configRequestTimeoutDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "config_request_timeout_seconds"),
+		"Deadline in seconds of each Google Stackdriver Monitoring API request, 0 for no deadline.",
+		nil,
+		constLabels,
+	)
+
+	var regionLabelSources []string
+	if options.RegionLabelSources != "" {
+		regionLabelSources = strings.Split(options.RegionLabelSources, ",")
+	}
+
+	var monitoredResourceTypes map[string]bool
+	if len(options.MonitoredResourceTypes) > 0 {
+		monitoredResourceTypes = make(map[string]bool)
+		for _, resourceType := range options.MonitoredResourceTypes {
+			monitoredResourceTypes[resourceType] = true
+		}
+	}
+
+	var metricKinds map[string]bool
+	if options.MetricKinds != "" {
+		metricKinds = make(map[string]bool)
+		for _, metricKind := range strings.Split(options.MetricKinds, ",") {
+			switch metricKind {
+			case "GAUGE", "DELTA", "CUMULATIVE":
+				metricKinds[metricKind] = true
+			default:
+				return nil, fmt.Errorf("Flag `monitoring.metric-kinds` is invalid: unknown metric kind %q", metricKind)
 			}
 		}
 	}
 
+	if options.ShardTotal < 1 {
+		return nil, errors.New("Flag `monitoring.shard-total` must be at least 1")
+	}
+	if options.ShardIndex < 0 || options.ShardIndex >= options.ShardTotal {
+		return nil, fmt.Errorf("Flag `monitoring.shard-index` must be between 0 and %d", options.ShardTotal-1)
+	}
+
+	var cache *descriptorCache
+	if options.DescriptorCacheTTL > 0 {
+		cache = newDescriptorCache(options.DescriptorCacheTTL)
+	}
+
+	var emptyDescriptors *descriptorCache
+	if options.EmptyDescriptorsCooldown > 0 {
+		emptyDescriptors = newDescriptorCache(options.EmptyDescriptorsCooldown)
+	}
+
+	// The descriptors of explicit Metric Types are always cached, they are
+	// fetched one by one and rarely change
+	if options.MetadataCacheTTL < 0 {
+		return nil, errors.New("Flag `monitoring.metadata-cache-ttl` must not be negative")
+	}
+	typeDescriptorCache := newDescriptorCache(options.MetadataCacheTTL)
+
+	if options.AggregateDeltasMaxEntries < 0 {
+		return nil, errors.New("Flag `monitoring.aggregate-deltas-max-entries` must not be negative")
+	}
+
+	if options.DeltaRates && options.AggregateDeltas {
+		return nil, errors.New("Flags `monitoring.delta-rates` and `monitoring.aggregate-deltas` are mutually exclusive")
+	}
+
+	var deltaCounters *deltaCounterStore
+	if options.AggregateDeltas {
+		deltaCounters = newDeltaCounterStore(options.AggregateDeltasTTL, options.AggregateDeltasMaxEntries)
+	}
+
 	monitoringCollector := &MonitoringCollector{
-		projectID:                       projectID,
-		metricsTypePrefixes:             filteredPrefixes,
-		metricsInterval:                 *monitoringMetricsInterval,
-		metricsOffset:                   *monitoringMetricsOffset,
-		monitoringService:               monitoringService,
-		apiCallsTotalMetric:             apiCallsTotalMetric,
-		scrapesTotalMetric:              scrapesTotalMetric,
-		scrapeErrorsTotalMetric:         scrapeErrorsTotalMetric,
-		lastScrapeErrorMetric:           lastScrapeErrorMetric,
-		lastScrapeTimestampMetric:       lastScrapeTimestampMetric,
-		lastScrapeDurationSecondsMetric: lastScrapeDurationSecondsMetric,
-		collectorFillMissingLabels:      *collectorFillMissingLabels,
-		monitoringDropDelegatedProjects: *monitoringDropDelegatedProjects,
-		logger:                          logger,
+		projectID:                         projectID,
+		descriptorsProjectID:              descriptorsProjectID,
+		namespace:                         namespace,
+		subsystem:                         subsystem,
+		metricsTypePrefixes:               collapsePrefixes(options.MetricsTypePrefixes),
+		metricsTypes:                      options.MetricsTypes,
+		metricsInterval:                   options.MetricsInterval,
+		metricsIntervalOverrides:          options.MetricsIntervalOverrides,
+		metricsOffset:                     options.MetricsOffset,
+		lookbackMultiplier:                options.LookbackMultiplier,
+		fixedIntervalStart:                fixedIntervalStart,
+		fixedIntervalEnd:                  fixedIntervalEnd,
+		monitoringService:                 monitoringService,
+		apiCallsTotalMetric:               apiCallsTotalMetric,
+		apiCallDurationSecondsMetric:      apiCallDurationSecondsMetric,
+		requestWaitSecondsMetric:          requestWaitSecondsMetric,
+		scrapesTotalMetric:                scrapesTotalMetric,
+		scrapeErrorsTotalMetric:           scrapeErrorsTotalMetric,
+		lastScrapeErrorMetric:             lastScrapeErrorMetric,
+		upMetric:                          upMetric,
+		lastScrapeTimestampMetric:         lastScrapeTimestampMetric,
+		lastScrapeDurationSecondsMetric:   lastScrapeDurationSecondsMetric,
+		descriptorCacheHitsTotalMetric:    descriptorCacheHitsTotalMetric,
+		descriptorCacheMissesTotalMetric:  descriptorCacheMissesTotalMetric,
+		metadataCacheHitsTotalMetric:      metadataCacheHitsTotalMetric,
+		metadataCacheMissesTotalMetric:    metadataCacheMissesTotalMetric,
+		timeSeriesTotalMetric:             timeSeriesTotalMetric,
+		seriesDroppedTotalMetric:          seriesDroppedTotalMetric,
+		negativeCounterValuesTotalMetric:  negativeCounterValuesTotalMetric,
+		partialScrapesTotalMetric:         partialScrapesTotalMetric,
+		emptyDescriptorsTotalMetric:       emptyDescriptorsTotalMetric,
+		pointAgeSecondsMetric:             pointAgeSecondsMetric,
+		queryWindowStartSecondsMetric:     queryWindowStartSecondsMetric,
+		queryWindowEndSecondsMetric:       queryWindowEndSecondsMetric,
+		prefixScrapeDurationSecondsMetric: prefixScrapeDurationSecondsMetric,
+		prefixPermissionErrorsTotalMetric: prefixPermissionErrorsTotalMetric,
+		metricDescriptorsMetric:           metricDescriptorsMetric,
+		metricIngestDelayDesc:             metricIngestDelayDesc,
+		metricSamplePeriodDesc:            metricSamplePeriodDesc,
+		metricInfoDesc:                    metricInfoDesc,
+		accumulatorEntriesDesc:            accumulatorEntriesDesc,
+		accumulatorEvictionsTotalDesc:     accumulatorEvictionsTotalDesc,
+		metadataCacheEntriesDesc:          metadataCacheEntriesDesc,
+		configIntervalDesc:                configIntervalDesc,
+		configIntervalOverrideDesc:        configIntervalOverrideDesc,
+		configOffsetDesc:                  configOffsetDesc,
+		configRequestTimeoutDesc:          configRequestTimeoutDesc,
+		collectorFillMissingLabels:        options.FillMissingLabels,
+		collectorDropEmptyLabels:          options.DropEmptyLabels,
+		collectorUnitAsSuffix:             options.UnitAsSuffix,
+		collectorMetricsWithTimestamp:     options.MetricsWithTimestamp,
+		collectorStringMetricsAsInfo:      options.StringMetricsAsInfo,
+		collectorDistributions:            options.Distributions,
+		collectorNonFiniteValues:          options.NonFiniteValues,
+		collectorNegativeCounterValues:    options.NegativeCounterValues,
+		collectorDropUnitLabel:            options.DropUnitLabel,
+		collectorUnitInHelp:               options.UnitInHelp,
+		collectorHelpMaxLength:            options.HelpMaxLength,
+		collectorHelpStripNewlines:        options.HelpStripNewlines,
+		collectorCounterTotalSuffix:       options.CounterTotalSuffix,
+		collectorMetricTypeLabel:          options.MetricTypeLabel,
+		collectorResourceTypeLabel:        options.ResourceTypeLabel,
+		resourceTypeNames:                 resourceTypeNames,
+		namespaceOverrides:                namespaceOverrides,
+		collectorRegionLabelSources:       regionLabelSources,
+		collectorMetadataLabels:           options.MetadataLabels,
+		collectorDescriptorMetadata:       options.DescriptorMetadata,
+		collectorMetricInfo:               options.MetricInfo,
+		collectorBestEffort:               options.BestEffort,
+		monitoringDropDelegatedProjects:   options.DropDelegatedProjects,
+		requestTimeout:                    options.RequestTimeout,
+		scrapeTimeout:                     options.ScrapeTimeout,
+		workers:                           newWorkerPool(options.MaxConcurrentRequests, requestWaitSecondsMetric),
+		prefixWorkers:                     newWorkerPool(options.MaxConcurrentPrefixes, nil),
+		prefixJitter:                      options.PrefixJitter,
+		maxDescriptorsPerPrefix:           options.MaxDescriptorsPerPrefix,
+		maxSeriesPerMetricType:            options.MaxSeriesPerMetricType,
+		descriptorCache:                   cache,
+		typeDescriptorCache:               typeDescriptorCache,
+		emptyDescriptors:                  emptyDescriptors,
+		metricsTypeInclude:                options.MetricsTypeInclude,
+		metricsTypeExclude:                options.MetricsTypeExclude,
+		monitoredResourceTypes:            monitoredResourceTypes,
+		metricKinds:                       metricKinds,
+		shardIndex:                        options.ShardIndex,
+		shardTotal:                        options.ShardTotal,
+		deltaCounters:                     deltaCounters,
+		newestPoints:                      make(map[string]time.Time),
+		permissionErrorsLogged:            make(map[string]time.Time),
+		deltaPoints:                       options.DeltaPoints,
+		deltaRates:                        options.DeltaRates,
+		timeSeriesView:                    options.TimeSeriesView,
+		pageSize:                          options.PageSize,
+		descriptorsBatchSize:              options.DescriptorsBatchSize,
+		aggregation:                       timeSeriesAggregation,
+		metricsFilters:                    options.MetricsFilters,
+		resourceTypes:                     options.ResourceTypes,
+		queries:                           queries,
+		labelRules:                        labelRules,
+		extraLabels:                       extraLabels,
+		logger:                            logger,
 	}
 
 	return monitoringCollector, nil
@@ -168,45 +1261,870 @@ func NewMonitoringCollector(projectID string, monitoringService *monitoring.Serv
 
 func (c *MonitoringCollector) Describe(ch chan<- *prometheus.Desc) {
 	c.apiCallsTotalMetric.Describe(ch)
+	c.apiCallDurationSecondsMetric.Describe(ch)
+	c.requestWaitSecondsMetric.Describe(ch)
 	c.scrapesTotalMetric.Describe(ch)
 	c.scrapeErrorsTotalMetric.Describe(ch)
 	c.lastScrapeErrorMetric.Describe(ch)
+	c.upMetric.Describe(ch)
 	c.lastScrapeTimestampMetric.Describe(ch)
 	c.lastScrapeDurationSecondsMetric.Describe(ch)
+	c.descriptorCacheHitsTotalMetric.Describe(ch)
+	c.descriptorCacheMissesTotalMetric.Describe(ch)
+	c.timeSeriesTotalMetric.Describe(ch)
+	c.seriesDroppedTotalMetric.Describe(ch)
+	c.negativeCounterValuesTotalMetric.Describe(ch)
+	c.partialScrapesTotalMetric.Describe(ch)
+	c.emptyDescriptorsTotalMetric.Describe(ch)
+	c.pointAgeSecondsMetric.Describe(ch)
+	c.queryWindowStartSecondsMetric.Describe(ch)
+	c.queryWindowEndSecondsMetric.Describe(ch)
+	c.prefixScrapeDurationSecondsMetric.Describe(ch)
+	c.prefixPermissionErrorsTotalMetric.Describe(ch)
+	c.metricDescriptorsMetric.Describe(ch)
+	if c.collectorDescriptorMetadata {
+		ch <- c.metricIngestDelayDesc
+		ch <- c.metricSamplePeriodDesc
+	}
+	if c.collectorMetricInfo {
+		ch <- c.metricInfoDesc
+	}
+	if c.deltaCounters != nil {
+		ch <- c.accumulatorEntriesDesc
+		ch <- c.accumulatorEvictionsTotalDesc
+	}
+	if len(c.metricsTypes) > 0 {
+		c.metadataCacheHitsTotalMetric.Describe(ch)
+		c.metadataCacheMissesTotalMetric.Describe(ch)
+		ch <- c.metadataCacheEntriesDesc
+	}
+	ch <- c.configIntervalDesc
+	ch <- c.configIntervalOverrideDesc
+	ch <- c.configOffsetDesc
+	ch <- c.configRequestTimeoutDesc
+}
+
+func (c *MonitoringCollector) Collect(ch chan<- prometheus.Metric) {
+	c.CollectWithContext(context.Background(), ch)
+}
+
+// CollectWithContext collects the metrics like Collect, aborting the API calls
+// in flight once the context is done, ie when the scrape client disconnects.
+func (c *MonitoringCollector) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	c.collect(ctx, nil, ch)
+}
+
+// CollectOnce runs a single scrape and returns a registry holding its metrics,
+// ie to push them to a Pushgateway with `push.New(...).Gatherer(registry)`,
+// along with the error of the scrape if any.
+func (c *MonitoringCollector) CollectOnce(ctx context.Context) (*prometheus.Registry, error) {
+	ch := make(chan prometheus.Metric)
+	collected := &collectedMetrics{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range ch {
+			collected.metrics = append(collected.metrics, metric)
+		}
+	}()
+	err := c.collect(ctx, nil, ch)
+	close(ch)
+	<-done
+
+	registry := prometheus.NewRegistry()
+	if registerErr := registry.Register(collected); registerErr != nil {
+		return nil, registerErr
+	}
+	return registry, err
+}
+
+// collectedMetrics is an unchecked collector reporting the metrics of a
+// scrape already run.
+type collectedMetrics struct {
+	metrics []prometheus.Metric
+}
+
+func (c *collectedMetrics) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *collectedMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+}
+
+// collect reports the metrics of a scrape and returns its error, if any. When
+// not empty, the filters restrict the scrape to the Metric Type prefixes and
+// Metric Types they hold.
+func (c *MonitoringCollector) collect(ctx context.Context, filters map[string]bool, ch chan<- prometheus.Metric) error {
+	var begun = time.Now()
+
+	if c.scrapeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.scrapeTimeout)
+		defer cancel()
+	}
+
+	errorMetric := float64(0)
+	err := c.reportMonitoringMetrics(ctx, filters, ch)
+	if c.otlpRecorder != nil && len(filters) == 0 {
+		c.otlpRecorder.completeScrape(begun, err == nil)
+	}
+	if err != nil {
+		errorMetric = float64(1)
+		for _, reason := range scrapeErrorReasons(err) {
+			c.scrapeErrorsTotalMetric.WithLabelValues(reason).Inc()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			level.Warn(c.logger).Log("msg", "Google Stackdriver Monitoring metrics scrape timed out, only the metrics collected so far are reported", "timeout", c.scrapeTimeout)
+		} else if ctx.Err() != nil {
+			level.Warn(c.logger).Log("msg", "Google Stackdriver Monitoring metrics scrape cancelled", "err", ctx.Err())
+		} else {
+			level.Error(c.logger).Log("msg", "Error while getting Google Stackdriver Monitoring metrics", "err", err)
+		}
+	}
+	c.scrapeErrorsTotalMetric.Collect(ch)
+
+	c.apiCallsTotalMetric.Collect(ch)
+	c.apiCallDurationSecondsMetric.Collect(ch)
+	c.requestWaitSecondsMetric.Collect(ch)
+
+	c.scrapesTotalMetric.Inc()
+	c.scrapesTotalMetric.Collect(ch)
+
+	c.lastScrapeErrorMetric.Set(errorMetric)
+	c.lastScrapeErrorMetric.Collect(ch)
+
+	c.upMetric.Collect(ch)
+
+	c.lastScrapeTimestampMetric.Set(float64(time.Now().Unix()))
+	c.lastScrapeTimestampMetric.Collect(ch)
+
+	c.lastScrapeDurationSecondsMetric.Set(time.Since(begun).Seconds())
+	c.lastScrapeDurationSecondsMetric.Collect(ch)
+
+	c.descriptorCacheHitsTotalMetric.Collect(ch)
+	c.descriptorCacheMissesTotalMetric.Collect(ch)
+
+	c.timeSeriesTotalMetric.Collect(ch)
+	c.seriesDroppedTotalMetric.Collect(ch)
+	c.negativeCounterValuesTotalMetric.Collect(ch)
+	c.partialScrapesTotalMetric.Collect(ch)
+	c.emptyDescriptorsTotalMetric.Collect(ch)
+	c.reportPointAges(time.Now())
+	c.pointAgeSecondsMetric.Collect(ch)
+	c.queryWindowStartSecondsMetric.Collect(ch)
+	c.queryWindowEndSecondsMetric.Collect(ch)
+	c.prefixScrapeDurationSecondsMetric.Collect(ch)
+	c.prefixPermissionErrorsTotalMetric.Collect(ch)
+	c.metricDescriptorsMetric.Collect(ch)
+	if c.deltaCounters != nil {
+		entries, evictions := c.deltaCounters.Stats()
+		ch <- prometheus.MustNewConstMetric(c.accumulatorEntriesDesc, prometheus.GaugeValue, float64(entries))
+		ch <- prometheus.MustNewConstMetric(c.accumulatorEvictionsTotalDesc, prometheus.CounterValue, float64(evictions))
+	}
+	if len(c.metricsTypes) > 0 {
+		c.metadataCacheHitsTotalMetric.Collect(ch)
+		c.metadataCacheMissesTotalMetric.Collect(ch)
+		ch <- prometheus.MustNewConstMetric(c.metadataCacheEntriesDesc, prometheus.GaugeValue, float64(c.typeDescriptorCache.Len()))
+	}
+	c.reportConfig(ch)
+
+	return err
+}
+
+// WithContext returns a collector collecting the metrics with the given
+// context, so a collector kept across scrapes can be registered once per
+// scrape request.
+func (c *MonitoringCollector) WithContext(ctx context.Context) prometheus.Collector {
+	return &contextCollector{collector: c, ctx: ctx}
+}
+
+// WithFilters returns a collector like WithContext, collecting only the
+// configured Metric Type prefixes and Metric Types found in the filters.
+// Filters matching none of them are ignored, so a scrape never collects
+// more than the collector is configured for.
+func (c *MonitoringCollector) WithFilters(ctx context.Context, filters map[string]bool) prometheus.Collector {
+	return &contextCollector{collector: c, ctx: ctx, filters: filters}
+}
+
+type contextCollector struct {
+	collector *MonitoringCollector
+	ctx       context.Context
+	filters   map[string]bool
+}
+
+func (c *contextCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+func (c *contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collector.collect(c.ctx, c.filters, ch)
+}
+
+// permissionErrorLogInterval is how often the permission errors of a prefix
+// are logged.
+const permissionErrorLogInterval = time.Hour
+
+// reportPermissionError counts a Metric Descriptors listing denied for a
+// prefix, logging it at most once per interval.
+func (c *MonitoringCollector) reportPermissionError(metricsTypePrefix string, err error) {
+	c.prefixPermissionErrorsTotalMetric.WithLabelValues(metricsTypePrefix).Inc()
+
+	c.permissionErrorsLock.Lock()
+	defer c.permissionErrorsLock.Unlock()
+
+	if logged, ok := c.permissionErrorsLogged[metricsTypePrefix]; ok && time.Since(logged) < permissionErrorLogInterval {
+		level.Debug(c.logger).Log("msg", "permission denied listing Google Stackdriver Monitoring metric descriptors", "prefix", metricsTypePrefix, "err", err)
+		return
+	}
+	c.permissionErrorsLogged[metricsTypePrefix] = time.Now()
+	level.Warn(c.logger).Log("msg", "permission denied listing Google Stackdriver Monitoring metric descriptors, skipping prefix", "prefix", metricsTypePrefix, "err", err)
+}
+
+// observeNewestPoint records the end time of the newest point retrieved for a
+// metric type, ignoring the zero time of pages without points.
+func (c *MonitoringCollector) observeNewestPoint(metricType string, endTime time.Time) {
+	if !endTime.After(time.Unix(0, 0)) {
+		return
+	}
+
+	c.newestPointsLock.Lock()
+	defer c.newestPointsLock.Unlock()
+
+	if endTime.After(c.newestPoints[metricType]) {
+		c.newestPoints[metricType] = endTime
+	}
+}
+
+// reportPointAges sets the age of the newest point of every metric type. The
+// age keeps growing while a metric type stops reporting new points.
+func (c *MonitoringCollector) reportPointAges(now time.Time) {
+	c.newestPointsLock.Lock()
+	defer c.newestPointsLock.Unlock()
+
+	for metricType, endTime := range c.newestPoints {
+		c.pointAgeSecondsMetric.WithLabelValues(metricType).Set(now.Sub(endTime).Seconds())
+	}
+}
+
+// observeAPICall records the duration of an API call begun at the given time.
+func (c *MonitoringCollector) observeAPICall(method string, begun time.Time) {
+	c.apiCallDurationSecondsMetric.WithLabelValues(method).Observe(time.Since(begun).Seconds())
+}
+
+// keepMetricType reports whether a metric type passes the include and exclude
+// expressions. A type matching the exclude expression is always dropped.
+func (c *MonitoringCollector) keepMetricType(metricType string) bool {
+	if c.metricsTypeExclude != nil && c.metricsTypeExclude.MatchString(metricType) {
+		return false
+	}
+	if c.metricsTypeInclude != nil && !c.metricsTypeInclude.MatchString(metricType) {
+		return false
+	}
+	return true
+}
+
+// observeEmptyDescriptor records a metric type whose Time Series listing
+// returned none, so it is skipped during the cooldown if any.
+func (c *MonitoringCollector) observeEmptyDescriptor(metricType string) {
+	c.emptyDescriptorsTotalMetric.WithLabelValues(metricType).Inc()
+	if c.emptyDescriptors != nil {
+		c.emptyDescriptors.Store(metricType, nil)
+	}
+}
+
+// inEmptyCooldown reports whether a metric type returned no Time Series
+// within the cooldown.
+func (c *MonitoringCollector) inEmptyCooldown(metricType string) bool {
+	if c.emptyDescriptors == nil {
+		return false
+	}
+	_, ok := c.emptyDescriptors.Lookup(metricType)
+	return ok
+}
+
+// keepMonitoredResourceTypes reports whether a metric descriptor is listed for
+// any of the monitored resource types to collect. Descriptors not listing
+// their monitored resource types are always kept.
+func (c *MonitoringCollector) keepMonitoredResourceTypes(descriptor *monitoring.MetricDescriptor) bool {
+	if c.monitoredResourceTypes == nil || len(descriptor.MonitoredResourceTypes) == 0 {
+		return true
+	}
+	for _, resourceType := range descriptor.MonitoredResourceTypes {
+		if c.monitoredResourceTypes[resourceType] {
+			return true
+		}
+	}
+	return false
+}
+
+// deltaRate reports whether the Time Series of a metric descriptor are
+// requested as per-second rates, which only INT64 and DOUBLE DELTA metrics
+// can be aligned to.
+func (c *MonitoringCollector) deltaRate(descriptor *monitoring.MetricDescriptor) bool {
+	if !c.deltaRates || descriptor.MetricKind != "DELTA" {
+		return false
+	}
+	return descriptor.ValueType == "INT64" || descriptor.ValueType == "DOUBLE"
+}
+
+// aggregationFor returns the server-side aggregation of the Time Series of a
+// metric descriptor.
+func (c *MonitoringCollector) aggregationFor(descriptor *monitoring.MetricDescriptor) aggregation {
+	if c.deltaRate(descriptor) {
+		return rateAggregation(c.metricsIntervalFor(descriptor.Type))
+	}
+	return c.aggregation
+}
+
+// keepMetricKind reports whether a metric descriptor is of a metric kind to
+// collect.
+func (c *MonitoringCollector) keepMetricKind(descriptor *monitoring.MetricDescriptor) bool {
+	return c.metricKinds == nil || c.metricKinds[descriptor.MetricKind]
+}
+
+// inShard reports whether a metric type is hashed to the shard of this
+// exporter replica.
+func (c *MonitoringCollector) inShard(metricType string) bool {
+	if c.shardTotal <= 1 {
+		return true
+	}
+	return jumpHash(hashAdd(hashNew(), metricType), c.shardTotal) == c.shardIndex
+}
+
+// jumpHash is the jump consistent hash of a key into a number of buckets, see
+// https://arxiv.org/abs/1406.2294. Only a few keys move to another bucket when
+// the number of buckets changes, so replicas can be added without reshuffling
+// most of the Metric Types.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// resourceTypeName returns the name to report for a monitored resource type,
+// the type itself unless renamed.
+func (c *MonitoringCollector) resourceTypeName(resourceType string) string {
+	if name, ok := c.resourceTypeNames[resourceType]; ok {
+		return name
+	}
+	return resourceType
+}
+
+// zonePattern matches a zone, capturing its region.
+var zonePattern = regexp.MustCompile(`^([a-z]+-[a-z]+[0-9]+)-[a-z]$`)
+
+// region derives the region of a monitored resource from the first of the
+// region label sources it has, turning a zone into its region.
+func (c *MonitoringCollector) region(resourceLabels map[string]string) (string, bool) {
+	for _, source := range c.collectorRegionLabelSources {
+		value, ok := resourceLabels[source]
+		if !ok || value == "" {
+			continue
+		}
+		if match := zonePattern.FindStringSubmatch(value); match != nil {
+			return match[1], true
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// reportConfig reports the interval, offset and request timeout the metrics
+// are collected with, so they can be told without looking at the flags.
+func (c *MonitoringCollector) reportConfig(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.configIntervalDesc, prometheus.GaugeValue, c.metricsInterval.Seconds())
+	for prefix, interval := range c.metricsIntervalOverrides {
+		ch <- prometheus.MustNewConstMetric(c.configIntervalOverrideDesc, prometheus.GaugeValue, interval.Seconds(), prefix)
+	}
+	ch <- prometheus.MustNewConstMetric(c.configOffsetDesc, prometheus.GaugeValue, c.metricsOffset.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.configRequestTimeoutDesc, prometheus.GaugeValue, c.requestTimeout.Seconds())
+}
+
+// namespaceOverride holds the namespace, and optionally the subsystem, of the
+// metrics of the Metric Types starting with a prefix.
+type namespaceOverride struct {
+	prefix       string
+	namespace    string
+	subsystem    string
+	hasSubsystem bool
+}
+
+// parseNamespaceOverrides parses a list of `prefix:namespace[:subsystem]`
+// overrides, by prefix. An empty subsystem drops the monitored resource type
+// from the metric names.
+func parseNamespaceOverrides(values []string) (map[string]*namespaceOverride, error) {
+	pairs, err := utils.ParsePrefixMap(values)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]*namespaceOverride, len(pairs))
+	for prefix, value := range pairs {
+		override := &namespaceOverride{prefix: prefix}
+		parts := strings.SplitN(value, ":", 2)
+		override.namespace = parts[0]
+		if len(parts) == 2 {
+			override.subsystem, override.hasSubsystem = parts[1], true
+		}
+		for _, name := range []string{override.namespace, override.subsystem} {
+			if name != "" && !model.IsValidMetricName(model.LabelValue(name)) {
+				return nil, fmt.Errorf("invalid namespace or subsystem %q for prefix %q", name, prefix)
+			}
+		}
+		overrides[prefix] = override
+	}
+	return overrides, nil
+}
+
+// namespaceOverrideFor returns the longest matching namespace override of a
+// metric type, if any.
+func (c *MonitoringCollector) namespaceOverrideFor(metricType string) *namespaceOverride {
+	var result *namespaceOverride
+	for prefix, override := range c.namespaceOverrides {
+		if strings.HasPrefix(metricType, prefix) && (result == nil || len(prefix) > len(result.prefix)) {
+			result = override
+		}
+	}
+	return result
+}
+
+// metricsIntervalFor returns the interval to request a metric type for, from
+// the longest matching interval override or the global interval.
+func (c *MonitoringCollector) metricsIntervalFor(metricType string) time.Duration {
+	interval, longestPrefix := c.metricsInterval, -1
+	for prefix, override := range c.metricsIntervalOverrides {
+		if strings.HasPrefix(metricType, prefix) && len(prefix) > longestPrefix {
+			interval, longestPrefix = override, len(prefix)
+		}
+	}
+	return interval
+}
+
+// timeSeriesInterval returns the interval to request the Time Series of a
+// metric type for. It ends the metrics offset before now, so the most recent
+// points, which may not be ingested yet, are not requested, and looks back the
+// lookback multiplier times the metrics interval. A fixed interval, ie to
+// replay recorded data, is always used as is.
+func (c *MonitoringCollector) timeSeriesInterval(metricType string, now time.Time) (time.Time, time.Time) {
+	if !c.fixedIntervalEnd.IsZero() {
+		return c.fixedIntervalStart, c.fixedIntervalEnd
+	}
+	endTime := now.Add(c.metricsOffset * -1)
+	lookback := c.metricsIntervalFor(metricType)
+	if c.lookbackMultiplier > 1 {
+		lookback = time.Duration(float64(lookback) * c.lookbackMultiplier)
+	}
+	return endTime.Add(lookback * -1), endTime
+}
+
+// timeSeriesFilter returns the Time Series filter for a metric type, including
+// the extra filters configured for the prefixes it starts with.
+func (c *MonitoringCollector) timeSeriesFilter(metricType string) string {
+	return c.metricTypesFilter([]string{metricType}) + c.prefixFilters(metricType)
+}
+
+// metricTypesFilter returns the Time Series filter clause selecting some
+// metric types.
+func (c *MonitoringCollector) metricTypesFilter(metricTypes []string) string {
+	filter := fmt.Sprintf("metric.type=\"%s\"", metricTypes[0])
+	if len(metricTypes) > 1 {
+		filter = fmt.Sprintf("metric.type = one_of(\"%s\")", strings.Join(metricTypes, "\", \""))
+	}
+	if c.monitoringDropDelegatedProjects {
+		filter = fmt.Sprintf("project=\"%s\" AND %s", c.projectID, filter)
+	}
+	return filter
+}
+
+// prefixFilters returns the extra filters configured for the prefixes a
+// metric type starts with, to AND to its Time Series filter.
+func (c *MonitoringCollector) prefixFilters(metricType string) string {
+	var prefixes []string
+	for prefix := range c.metricsFilters {
+		if strings.HasPrefix(metricType, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+
+	var filter string
+	for _, prefix := range prefixes {
+		filter = fmt.Sprintf("%s AND (%s)", filter, c.metricsFilters[prefix])
+	}
+	return filter
+}
+
+// collapsePrefixes returns the minimal set of prefixes covering the given
+// ones, in their original order. A prefix starting with another one lists a
+// subset of its descriptors, so it is dropped.
+func collapsePrefixes(prefixes []string) []string {
+	var collapsed []string
+	for i, prefix := range prefixes {
+		covered := false
+		for j, other := range prefixes {
+			// Of two equal prefixes only the first one is kept
+			if i != j && strings.HasPrefix(prefix, other) && (prefix != other || j < i) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			collapsed = append(collapsed, prefix)
+		}
+	}
+	return collapsed
+}
+
+// dropScrapedDescriptors drops the descriptors of the metric types already
+// scraped by another prefix. Prefixes may overlap, ie `compute.googleapis.com/`
+// and `compute.googleapis.com/instance/`, and scraping a metric type twice
+// reports duplicate metrics.
+func dropScrapedDescriptors(scrapedTypes *sync.Map, descriptors map[string]*monitoring.MetricDescriptor) {
+	for metricType := range descriptors {
+		if _, scraped := scrapedTypes.LoadOrStore(metricType, true); scraped {
+			delete(descriptors, metricType)
+		}
+	}
+}
+
+// resourceTypesFor returns the monitored resource types to collect a metric
+// descriptor for, from the prefixes it starts with. The ones the descriptor
+// is not listed for are dropped, and false is returned when none is left.
+func (c *MonitoringCollector) resourceTypesFor(descriptor *monitoring.MetricDescriptor) ([]string, bool) {
+	configured := make(map[string]bool)
+	for prefix, types := range c.resourceTypes {
+		if strings.HasPrefix(descriptor.Type, prefix) {
+			for _, resourceType := range types {
+				configured[resourceType] = true
+			}
+		}
+	}
+	if len(configured) == 0 {
+		return nil, true
+	}
+
+	listed := make(map[string]bool, len(descriptor.MonitoredResourceTypes))
+	for _, resourceType := range descriptor.MonitoredResourceTypes {
+		listed[resourceType] = true
+	}
+	var resourceTypes []string
+	for resourceType := range configured {
+		// Descriptors not listing their monitored resource types can not be
+		// validated
+		if len(listed) == 0 || listed[resourceType] {
+			resourceTypes = append(resourceTypes, resourceType)
+		}
+	}
+	sort.Strings(resourceTypes)
+	return resourceTypes, len(resourceTypes) > 0
+}
+
+// descriptorTimeSeriesFilter returns the Time Series filter for a metric
+// descriptor, restricted to the monitored resource types to collect it for.
+func (c *MonitoringCollector) descriptorTimeSeriesFilter(descriptor *monitoring.MetricDescriptor) string {
+	return c.batchTimeSeriesFilter([]*monitoring.MetricDescriptor{descriptor})
+}
+
+// batchTimeSeriesFilter returns the Time Series filter for a batch of metric
+// descriptors sharing their extra filters.
+func (c *MonitoringCollector) batchTimeSeriesFilter(batch []*monitoring.MetricDescriptor) string {
+	metricTypes := make([]string, len(batch))
+	for i, descriptor := range batch {
+		metricTypes[i] = descriptor.Type
+	}
+	return c.metricTypesFilter(metricTypes) + c.extraFilters(batch[0])
+}
+
+// extraFilters returns the filters to AND to the metric type clause of the
+// Time Series filter of a metric descriptor.
+func (c *MonitoringCollector) extraFilters(descriptor *monitoring.MetricDescriptor) string {
+	filter := c.prefixFilters(descriptor.Type)
+	resourceTypes, _ := c.resourceTypesFor(descriptor)
+	if len(resourceTypes) == 0 {
+		return filter
+	}
+	clauses := make([]string, len(resourceTypes))
+	for i, resourceType := range resourceTypes {
+		clauses[i] = fmt.Sprintf("resource.type=\"%s\"", resourceType)
+	}
+	return fmt.Sprintf("%s AND (%s)", filter, strings.Join(clauses, " OR "))
+}
+
+// batchDescriptors groups the descriptors sharing their Time Series interval
+// and extra filters into batches requested with a single Time Series filter,
+// of up to the descriptors batch size and the max filter length.
+func (c *MonitoringCollector) batchDescriptors(descriptors map[string]*monitoring.MetricDescriptor) [][]*monitoring.MetricDescriptor {
+	metricTypes := make([]string, 0, len(descriptors))
+	for metricType := range descriptors {
+		metricTypes = append(metricTypes, metricType)
+	}
+	sort.Strings(metricTypes)
+
+	var batches [][]*monitoring.MetricDescriptor
+	open := make(map[string]int)
+	for _, metricType := range metricTypes {
+		descriptor := descriptors[metricType]
+		key := fmt.Sprintf("%s/%t%s", c.metricsIntervalFor(metricType), c.deltaRate(descriptor), c.extraFilters(descriptor))
+		if i, ok := open[key]; ok {
+			batch := append(batches[i], descriptor)
+			if c.filterBuilder == nil && len(batch) <= c.descriptorsBatchSize && len(c.batchTimeSeriesFilter(batch)) <= maxFilterLength {
+				batches[i] = batch
+				continue
+			}
+		}
+		open[key] = len(batches)
+		batches = append(batches, []*monitoring.MetricDescriptor{descriptor})
+	}
+	return batches
+}
+
+// limitDescriptors drops the descriptors exceeding the max number of
+// descriptors per prefix, keeping the first ones in Metric Type order.
+func (c *MonitoringCollector) limitDescriptors(descriptors map[string]*monitoring.MetricDescriptor) {
+	if c.maxDescriptorsPerPrefix <= 0 || len(descriptors) <= c.maxDescriptorsPerPrefix {
+		return
+	}
+
+	metricTypes := make([]string, 0, len(descriptors))
+	for metricType := range descriptors {
+		metricTypes = append(metricTypes, metricType)
+	}
+	sort.Strings(metricTypes)
+
+	level.Warn(c.logger).Log("msg", "too many Google Stackdriver Monitoring metric descriptors, skipping some of them", "descriptors", len(descriptors), "max", c.maxDescriptorsPerPrefix, "first_skipped", metricTypes[c.maxDescriptorsPerPrefix])
+	for _, metricType := range metricTypes[c.maxDescriptorsPerPrefix:] {
+		delete(descriptors, metricType)
+	}
+}
+
+// limitTimeSeries drops the Time Series of a page exceeding the max number of
+// series per Metric Type, given the number already reported on this scrape,
+// and reports whether the max was reached. The remaining pages are not
+// requested, so their series are not counted as dropped.
+func (c *MonitoringCollector) limitTimeSeries(metricType string, page *monitoring.ListTimeSeriesResponse, reportedSeries int) bool {
+	if c.maxSeriesPerMetricType <= 0 {
+		return false
+	}
+
+	remaining := c.maxSeriesPerMetricType - reportedSeries
+	if len(page.TimeSeries) < remaining {
+		return false
+	}
+	if dropped := len(page.TimeSeries) - remaining; dropped > 0 || page.NextPageToken != "" {
+		level.Warn(c.logger).Log("msg", "too many Google Stackdriver Monitoring Time Series, skipping some of them", "metric", metricType, "max", c.maxSeriesPerMetricType)
+		c.seriesDroppedTotalMetric.WithLabelValues(metricType).Add(float64(dropped))
+		page.TimeSeries = page.TimeSeries[:remaining]
+	}
+	return true
+}
+
+// requestContext returns the context to use for a single Google Stackdriver
+// Monitoring API request, bounded by the configured request timeout.
+func (c *MonitoringCollector) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout > 0 {
+		return context.WithTimeout(ctx, c.requestTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// metricDescriptorsFilter returns the filter to list the metric descriptors
+// starting with a prefix.
+func (c *MonitoringCollector) metricDescriptorsFilter(metricsTypePrefix string) string {
+	if c.monitoringDropDelegatedProjects {
+		return fmt.Sprintf(
+			"project = \"%s\" AND metric.type = starts_with(\"%s\")",
+			c.projectID,
+			metricsTypePrefix)
+	}
+	return fmt.Sprintf("metric.type = starts_with(\"%s\")", metricsTypePrefix)
+}
+
+// metricDescriptorsListCall returns the call listing the metric descriptors
+// starting with a prefix.
+func (c *MonitoringCollector) metricDescriptorsListCall(metricsTypePrefix string) *monitoring.ProjectsMetricDescriptorsListCall {
+	call := c.monitoringService.Projects.MetricDescriptors.List(utils.ProjectResource(c.descriptorsProjectID)).
+		Filter(c.metricDescriptorsFilter(metricsTypePrefix))
+	if c.pageSize > 0 {
+		call.PageSize(c.pageSize)
+	}
+	return call
+}
+
+// MetricsTypePrefixes returns the Metric Type prefixes collected.
+func (c *MonitoringCollector) MetricsTypePrefixes() []string {
+	return c.metricsTypePrefixes
+}
+
+// ListMetricDescriptors returns all the metric descriptors starting with a
+// prefix, without collecting their Time Series, ie to discover the metrics
+// available for a service.
+func (c *MonitoringCollector) ListMetricDescriptors(metricsTypePrefix string) ([]*monitoring.MetricDescriptor, error) {
+	ctx := context.Background()
+	metricDescriptorsListCall := c.metricDescriptorsListCall(metricsTypePrefix)
+
+	var descriptors []*monitoring.MetricDescriptor
+	for {
+		var page *monitoring.ListMetricDescriptorsResponse
+		err := c.workers.Do(ctx, func() error {
+			c.apiCallsTotalMetric.Inc()
+			requestCtx, cancel := c.requestContext(ctx)
+			defer cancel()
+			defer c.observeAPICall("metricDescriptors.list", time.Now())
+			var err error
+			page, err = metricDescriptorsListCall.Context(requestCtx).Do()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		descriptors = append(descriptors, page.MetricDescriptors...)
+		if page.NextPageToken == "" {
+			return descriptors, nil
+		}
+		metricDescriptorsListCall.PageToken(page.NextPageToken)
+	}
+}
+
+// Ping lists a single metric descriptor to check the Google Stackdriver
+// Monitoring API can be reached with the configured credentials, without
+// running a scrape. Like any other API call, it runs on the worker pool and
+// is counted in the collector metrics.
+func (c *MonitoringCollector) Ping(ctx context.Context) error {
+	return c.workers.Do(ctx, func() error {
+		c.apiCallsTotalMetric.Inc()
+		requestCtx, cancel := c.requestContext(ctx)
+		defer cancel()
+		defer c.observeAPICall("metricDescriptors.list", time.Now())
+		_, err := c.monitoringService.Projects.MetricDescriptors.List(utils.ProjectResource(c.descriptorsProjectID)).
+			PageSize(1).
+			Context(requestCtx).
+			Do()
+		return err
+	})
+}
+
+// getMetricDescriptor returns the descriptor of a Metric Type, from the cache
+// or from the API.
+func (c *MonitoringCollector) getMetricDescriptor(ctx context.Context, metricType string) (*monitoring.MetricDescriptor, error) {
+	if descriptors, ok := c.typeDescriptorCache.Lookup(metricType); ok {
+		c.metadataCacheHitsTotalMetric.Inc()
+		return descriptors[0], nil
+	}
+	c.metadataCacheMissesTotalMetric.Inc()
+
+	level.Debug(c.logger).Log("msg", "getting Google Stackdriver Monitoring metric descriptor", "descriptor", metricType)
+	var descriptor *monitoring.MetricDescriptor
+	err := c.workers.Do(ctx, func() error {
+		c.apiCallsTotalMetric.Inc()
+		requestCtx, cancel := c.requestContext(ctx)
+		defer cancel()
+		defer c.observeAPICall("metricDescriptors.get", time.Now())
+		var err error
+		descriptor, err = c.monitoringService.Projects.MetricDescriptors.Get(utils.MetricDescriptorResource(c.descriptorsProjectID, metricType)).Context(requestCtx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error getting metric descriptor %s: %v", metricType, err)
+	}
+
+	c.typeDescriptorCache.Store(metricType, []*monitoring.MetricDescriptor{descriptor})
+	return descriptor, nil
+}
+
+// PointParseError is returned when the interval end time of a Time Series
+// point can not be parsed.
+type PointParseError struct {
+	MetricType string
+	EndTime    string
+	Err        error
+}
+
+func (e *PointParseError) Error() string {
+	return fmt.Sprintf("Error parsing TimeSeries Point interval end time `%s` of metric %s: %s", e.EndTime, e.MetricType, e.Err)
+}
+
+func (e *PointParseError) Unwrap() error {
+	return e.Err
 }
 
-func (c *MonitoringCollector) Collect(ch chan<- prometheus.Metric) {
-	var begun = time.Now()
+// scrapeErrors gathers the errors of a best effort scrape.
+type scrapeErrors []error
 
-	errorMetric := float64(0)
-	if err := c.reportMonitoringMetrics(ch); err != nil {
-		errorMetric = float64(1)
-		c.scrapeErrorsTotalMetric.Inc()
-		level.Error(c.logger).Log("msg", "Error while getting Google Stackdriver Monitoring metrics", "err", err)
+func (e scrapeErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
 	}
-	c.scrapeErrorsTotalMetric.Collect(ch)
+	return strings.Join(messages, "; ")
+}
 
-	c.apiCallsTotalMetric.Collect(ch)
+// err returns nil when there are no errors, the only error when there is
+// just one, or all of them otherwise.
+func (e scrapeErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
 
-	c.scrapesTotalMetric.Inc()
-	c.scrapesTotalMetric.Collect(ch)
+// drainErrors returns the first error sent to a closed error channel, or all
+// of them in best effort mode.
+func (c *MonitoringCollector) drainErrors(errChannel <-chan error) error {
+	if !c.collectorBestEffort {
+		return <-errChannel
+	}
+	var errs scrapeErrors
+	for err := range errChannel {
+		if nested, ok := err.(scrapeErrors); ok {
+			errs = append(errs, nested...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	return errs.err()
+}
 
-	c.lastScrapeErrorMetric.Set(errorMetric)
-	c.lastScrapeErrorMetric.Collect(ch)
+// filteredMetricsTypes returns the Metric Type prefixes and Metric Types to
+// scrape, restricted to the filters when not empty.
+func (c *MonitoringCollector) filteredMetricsTypes(filters map[string]bool) ([]string, []string) {
+	if len(filters) == 0 {
+		return c.metricsTypePrefixes, c.metricsTypes
+	}
+	var metricsTypePrefixes, metricsTypes []string
+	for _, prefix := range c.metricsTypePrefixes {
+		if filters[prefix] {
+			metricsTypePrefixes = append(metricsTypePrefixes, prefix)
+		}
+	}
+	for _, metricType := range c.metricsTypes {
+		if filters[metricType] {
+			metricsTypes = append(metricsTypes, metricType)
+		}
+	}
+	return metricsTypePrefixes, metricsTypes
+}
 
-	c.lastScrapeTimestampMetric.Set(float64(time.Now().Unix()))
-	c.lastScrapeTimestampMetric.Collect(ch)
+func (c *MonitoringCollector) reportMonitoringMetrics(ctx context.Context, filters map[string]bool, ch chan<- prometheus.Metric) error {
+	metricsTypePrefixes, metricsTypes := c.filteredMetricsTypes(filters)
 
-	c.lastScrapeDurationSecondsMetric.Set(time.Since(begun).Seconds())
-	c.lastScrapeDurationSecondsMetric.Collect(ch)
-}
+	if c.deltaCounters != nil {
+		c.deltaCounters.Evict()
+	}
 
-func (c *MonitoringCollector) reportMonitoringMetrics(ch chan<- prometheus.Metric) error {
+	// API calls of every prefix and descriptor run on the shared worker pool.
+	// Only the per prefix goroutines wait for other tasks, and they do so
+	// without holding a worker.
+	var scrapedTypes sync.Map
 	metricDescriptorsFunction := func(page *monitoring.ListMetricDescriptorsResponse) error {
 		var wg = &sync.WaitGroup{}
 
-		c.apiCallsTotalMetric.Inc()
-
 		// It has been noticed that the same metric descriptor can be obtained from different GCP
 		// projects. When that happens, metrics are fetched twice and it provokes the error:
 		//     "collected metric xxx was collected before with the same name and label values"
@@ -218,90 +2136,435 @@ func (c *MonitoringCollector) reportMonitoringMetrics(ch chan<- prometheus.Metri
 		// The following makes sure metric descriptors are unique to avoid fetching more than once
 		uniqueDescriptors := make(map[string]*monitoring.MetricDescriptor)
 		for _, descriptor := range page.MetricDescriptors {
+			if !c.keepMetricType(descriptor.Type) || !c.keepMonitoredResourceTypes(descriptor) || !c.keepMetricKind(descriptor) {
+				level.Debug(c.logger).Log("msg", "skipping filtered out Google Stackdriver Monitoring metric descriptor", "descriptor", descriptor.Type)
+				continue
+			}
+			if !c.inShard(descriptor.Type) {
+				level.Debug(c.logger).Log("msg", "skipping Google Stackdriver Monitoring metric descriptor of another shard", "descriptor", descriptor.Type)
+				continue
+			}
+			if _, ok := c.resourceTypesFor(descriptor); !ok {
+				level.Debug(c.logger).Log("msg", "skipping Google Stackdriver Monitoring metric descriptor listed for none of the resource types to collect", "descriptor", descriptor.Type)
+				continue
+			}
+			if c.inEmptyCooldown(descriptor.Type) {
+				level.Debug(c.logger).Log("msg", "skipping Google Stackdriver Monitoring metric descriptor without Time Series recently", "descriptor", descriptor.Type)
+				continue
+			}
 			uniqueDescriptors[descriptor.Type] = descriptor
 		}
+		c.limitDescriptors(uniqueDescriptors)
+		dropScrapedDescriptors(&scrapedTypes, uniqueDescriptors)
+
+		for _, metricDescriptor := range uniqueDescriptors {
+			if c.collectorDescriptorMetadata {
+				c.reportDescriptorMetadata(metricDescriptor, ch)
+			}
+			if c.collectorMetricInfo {
+				c.reportMetricInfo(metricDescriptor, ch)
+			}
+		}
 
-		errChannel := make(chan error, len(uniqueDescriptors))
+		batches := c.batchDescriptors(uniqueDescriptors)
+		errChannel := make(chan error, len(batches))
 
-		endTime := time.Now().UTC().Add(c.metricsOffset * -1)
-		startTime := endTime.Add(c.metricsInterval * -1)
+		now := time.Now().UTC()
 
-		for _, metricDescriptor := range uniqueDescriptors {
+		for _, batch := range batches {
+			batch := batch
 			wg.Add(1)
-			go func(metricDescriptor *monitoring.MetricDescriptor, ch chan<- prometheus.Metric) {
+			err := c.workers.Go(ctx, func() {
 				defer wg.Done()
-				level.Debug(c.logger).Log("msg", "retrieving Google Stackdriver Monitoring metrics for descriptor", "descriptor", metricDescriptor.Type)
-				filter := fmt.Sprintf("metric.type=\"%s\"", metricDescriptor.Type)
-				if c.monitoringDropDelegatedProjects {
-					filter = fmt.Sprintf(
-						"project=\"%s\" AND metric.type=\"%s\"",
-						c.projectID,
-						metricDescriptor.Type)
-				}
-				timeSeriesListCall := c.monitoringService.Projects.TimeSeries.List(utils.ProjectResource(c.projectID)).
-					Filter(filter).
-					IntervalStartTime(startTime.Format(time.RFC3339Nano)).
-					IntervalEndTime(endTime.Format(time.RFC3339Nano))
-
-				for {
-					c.apiCallsTotalMetric.Inc()
-					page, err := timeSeriesListCall.Do()
-					if err != nil {
-						level.Error(c.logger).Log("msg", "error retrieving Time Series metrics for descriptor", "descriptor", metricDescriptor.Type, "err", err)
-						errChannel <- err
-						break
-					}
-					if page == nil {
-						break
-					}
-					if err := c.reportTimeSeriesMetrics(page, metricDescriptor, ch); err != nil {
-						level.Error(c.logger).Log("msg", "error reporting Time Series metrics for descripto", "descriptor", metricDescriptor.Type, "err", err)
-						errChannel <- err
-						break
-					}
-					if page.NextPageToken == "" {
-						break
+				defer func() {
+					// A malformed Time Series must not take the whole exporter down
+					if r := recover(); r != nil {
+						level.Error(c.logger).Log("msg", "recovered from panic reporting Time Series metrics for descriptor", "descriptor", batchTypes(batch), "panic", r)
+						errChannel <- fmt.Errorf("panic reporting Time Series metrics for descriptor %s: %v", batchTypes(batch), r)
 					}
-					timeSeriesListCall.PageToken(page.NextPageToken)
+				}()
+				if err := c.reportTimeSeriesBatch(ctx, batch, now, ch); err != nil {
+					errChannel <- err
 				}
-			}(metricDescriptor, ch)
+			})
+			if err != nil {
+				wg.Done()
+				errChannel <- err
+			}
 		}
 
 		wg.Wait()
 		close(errChannel)
 
-		return <-errChannel
+		return c.drainErrors(errChannel)
 	}
 
 	var wg = &sync.WaitGroup{}
 
-	errChannel := make(chan error, len(c.metricsTypePrefixes))
+	errChannel := make(chan error, len(metricsTypePrefixes)+len(c.queries)+1)
 
-	for _, metricsTypePrefix := range c.metricsTypePrefixes {
+	// Number of prefixes whose Metric Descriptors were listed, and how many of
+	// those listings succeeded, to tell whether Stackdriver could be reached
+	var listingsTotal, listingsSucceeded int32
+
+	for _, metricsTypePrefix := range metricsTypePrefixes {
 		wg.Add(1)
 		go func(metricsTypePrefix string) {
 			defer wg.Done()
+			// A prefix keeps its slot while waiting for the workers of its
+			// API calls, which never wait for a prefix slot themselves, so
+			// both limits can not deadlock
+			if err := c.prefixWorkers.acquire(ctx); err != nil {
+				errChannel <- err
+				return
+			}
+			defer c.prefixWorkers.release()
+			if c.prefixJitter > 0 {
+				select {
+				case <-ctx.Done():
+					errChannel <- ctx.Err()
+					return
+				case <-time.After(jitterDelay(c.prefixJitter)):
+				}
+			}
+			begun := time.Now()
+			defer func() {
+				c.prefixScrapeDurationSecondsMetric.WithLabelValues(metricsTypePrefix).Set(time.Since(begun).Seconds())
+			}()
+			if c.descriptorCache != nil {
+				if descriptors, ok := c.descriptorCache.Lookup(metricsTypePrefix); ok {
+					c.descriptorCacheHitsTotalMetric.Inc()
+					c.metricDescriptorsMetric.WithLabelValues(metricsTypePrefix).Set(float64(len(descriptors)))
+					level.Debug(c.logger).Log("msg", "using cached Google Stackdriver Monitoring metric descriptors starting with", "prefix", metricsTypePrefix)
+					if err := metricDescriptorsFunction(&monitoring.ListMetricDescriptorsResponse{MetricDescriptors: descriptors}); err != nil {
+						errChannel <- err
+					}
+					return
+				}
+				c.descriptorCacheMissesTotalMetric.Inc()
+			}
+
 			level.Debug(c.logger).Log("msg", "listing Google Stackdriver Monitoring metric descriptors starting with", "prefix", metricsTypePrefix)
-			ctx := context.Background()
-			filter := fmt.Sprintf("metric.type = starts_with(\"%s\")", metricsTypePrefix)
-			if c.monitoringDropDelegatedProjects {
-				filter = fmt.Sprintf(
-					"project = \"%s\" AND metric.type = starts_with(\"%s\")",
-					c.projectID,
-					metricsTypePrefix)
-			}
-			if err := c.monitoringService.Projects.MetricDescriptors.List(utils.ProjectResource(c.projectID)).
-				Filter(filter).
-				Pages(ctx, metricDescriptorsFunction); err != nil {
+			metricDescriptorsListCall := c.metricDescriptorsListCall(metricsTypePrefix)
+
+			var descriptors []*monitoring.MetricDescriptor
+			var errs scrapeErrors
+			firstPage := true
+			for {
+				var page *monitoring.ListMetricDescriptorsResponse
+				err := c.workers.Do(ctx, func() error {
+					c.apiCallsTotalMetric.Inc()
+					requestCtx, cancel := c.requestContext(ctx)
+					defer cancel()
+					defer c.observeAPICall("metricDescriptors.list", time.Now())
+					var err error
+					page, err = metricDescriptorsListCall.Context(requestCtx).Do()
+					return err
+				})
+				if firstPage {
+					atomic.AddInt32(&listingsTotal, 1)
+					if err == nil {
+						atomic.AddInt32(&listingsSucceeded, 1)
+					}
+					firstPage = false
+				}
+				if err != nil && isPermissionDeniedError(err) {
+					// The service account may only have access to some
+					// prefixes, the accessible ones are still collected
+					c.reportPermissionError(metricsTypePrefix, err)
+					c.metricDescriptorsMetric.WithLabelValues(metricsTypePrefix).Set(0)
+					return
+				}
+				if err != nil {
+					errs = append(errs, err)
+					break
+				}
+				descriptors = append(descriptors, page.MetricDescriptors...)
+				// With a max number of descriptors, they are reported once all
+				// of them are listed so the max applies to the whole prefix
+				if c.maxDescriptorsPerPrefix <= 0 {
+					if err := metricDescriptorsFunction(page); err != nil {
+						errs = append(errs, err)
+						if !c.collectorBestEffort {
+							break
+						}
+					}
+				}
+				if page.NextPageToken == "" {
+					c.metricDescriptorsMetric.WithLabelValues(metricsTypePrefix).Set(float64(len(descriptors)))
+					break
+				}
+				metricDescriptorsListCall.PageToken(page.NextPageToken)
+			}
+			if c.maxDescriptorsPerPrefix > 0 && len(errs) == 0 {
+				if err := metricDescriptorsFunction(&monitoring.ListMetricDescriptorsResponse{MetricDescriptors: descriptors}); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if err := errs.err(); err != nil {
 				errChannel <- err
+				return
+			}
+
+			if c.descriptorCache != nil {
+				c.descriptorCache.Store(metricsTypePrefix, descriptors)
 			}
 		}(metricsTypePrefix)
 	}
 
+	if len(metricsTypes) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var descriptors []*monitoring.MetricDescriptor
+			var errs scrapeErrors
+			for _, metricType := range metricsTypes {
+				descriptor, err := c.getMetricDescriptor(ctx, metricType)
+				if err != nil {
+					errs = append(errs, err)
+					if !c.collectorBestEffort {
+						break
+					}
+					continue
+				}
+				descriptors = append(descriptors, descriptor)
+			}
+			if len(errs) == 0 || c.collectorBestEffort {
+				if err := metricDescriptorsFunction(&monitoring.ListMetricDescriptorsResponse{MetricDescriptors: descriptors}); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if err := errs.err(); err != nil {
+				errChannel <- err
+			}
+		}()
+	}
+
+	for name, query := range c.queries {
+		wg.Add(1)
+		go func(name string, query string) {
+			defer wg.Done()
+			if err := c.reportQueryMetrics(ctx, name, query, ch); err != nil {
+				errChannel <- err
+			}
+		}(name, query)
+	}
+
 	wg.Wait()
 	close(errChannel)
 
-	return <-errChannel
+	// Keep the previous value when every prefix was served from the cache
+	if listingsTotal > 0 {
+		if listingsSucceeded > 0 {
+			c.upMetric.Set(1)
+		} else {
+			c.upMetric.Set(0)
+		}
+	}
+
+	return c.drainErrors(errChannel)
+}
+
+// batchTypes returns the metric types of a batch of descriptors, to log it.
+func batchTypes(batch []*monitoring.MetricDescriptor) string {
+	metricTypes := make([]string, len(batch))
+	for i, descriptor := range batch {
+		metricTypes[i] = descriptor.Type
+	}
+	return strings.Join(metricTypes, ",")
+}
+
+// reportTimeSeriesBatch lists the Time Series of a batch of descriptors with a
+// single filter, and reports them by metric type.
+func (c *MonitoringCollector) reportTimeSeriesBatch(ctx context.Context, batch []*monitoring.MetricDescriptor, now time.Time, ch chan<- prometheus.Metric) error {
+	descriptors := make(map[string]*monitoring.MetricDescriptor, len(batch))
+	for _, metricDescriptor := range batch {
+		descriptors[metricDescriptor.Type] = metricDescriptor
+	}
+	metricTypes := batchTypes(batch)
+
+	level.Debug(c.logger).Log("msg", "retrieving Google Stackdriver Monitoring metrics for descriptor", "descriptor", metricTypes)
+	// Descriptors are only batched when they share their interval
+	startTime, endTime := c.timeSeriesInterval(batch[0].Type, now)
+	for metricType := range descriptors {
+		c.queryWindowStartSecondsMetric.WithLabelValues(metricType).Set(float64(startTime.Unix()))
+		c.queryWindowEndSecondsMetric.WithLabelValues(metricType).Set(float64(endTime.Unix()))
+	}
+	timeSeriesListCall := c.monitoringService.Projects.TimeSeries.List(utils.ScopeResource(c.projectID)).
+		Filter(c.timeSeriesListFilter(batch)).
+		IntervalStartTime(startTime.Format(time.RFC3339Nano)).
+		IntervalEndTime(endTime.Format(time.RFC3339Nano)).
+		View(c.timeSeriesView)
+	// Descriptors are only batched when they share their aggregation too
+	c.aggregationFor(batch[0]).apply(timeSeriesListCall)
+	if c.pageSize > 0 {
+		timeSeriesListCall.PageSize(c.pageSize)
+	}
+
+	// Looking back over several intervals, the points of a series may be
+	// split across pages, which are merged so the series is reported once
+	// with its freshest point
+	var merged *timeSeriesMerger
+	if c.lookbackMultiplier > 1 {
+		merged = newTimeSeriesMerger()
+	}
+
+	reportedSeries := make(map[string]int, len(batch))
+	totalSeries, reportedPages := 0, 0
+	for {
+		var page *monitoring.ListTimeSeriesResponse
+		err := func() error {
+			c.apiCallsTotalMetric.Inc()
+			requestCtx, cancel := c.requestContext(ctx)
+			defer cancel()
+			defer c.observeAPICall("timeSeries.list", time.Now())
+			var err error
+			page, err = timeSeriesListCall.Context(requestCtx).Do()
+			return err
+		}()
+		if err != nil {
+			if reportedPages > 0 {
+				// The metrics of the previous pages are reported already
+				c.partialScrapesTotalMetric.Inc()
+				level.Error(c.logger).Log("msg", "error retrieving Time Series metrics for descriptor, only some pages were reported", "descriptor", metricTypes, "pages", reportedPages, "series", totalSeries, "err", err)
+			} else {
+				level.Error(c.logger).Log("msg", "error retrieving Time Series metrics for descriptor", "descriptor", metricTypes, "err", err)
+			}
+			return err
+		}
+		if page == nil {
+			return nil
+		}
+
+		maxReached := false
+		for _, typePage := range splitTimeSeriesPage(page, len(batch) > 1) {
+			metricType := batch[0].Type
+			if len(batch) > 1 {
+				metricType = typePage.TimeSeries[0].Metric.Type
+			}
+			metricDescriptor, ok := descriptors[metricType]
+			if !ok {
+				continue
+			}
+			// The remaining pages of a batch may hold the Time Series of
+			// metric types not at their max yet
+			if c.limitTimeSeries(metricType, typePage, reportedSeries[metricType]) && len(batch) == 1 {
+				maxReached = true
+			}
+			reportedSeries[metricType] += len(typePage.TimeSeries)
+			totalSeries += len(typePage.TimeSeries)
+			if merged != nil {
+				merged.add(metricType, typePage)
+				continue
+			}
+			if err := c.reportTimeSeriesMetrics(typePage, metricDescriptor, ch); err != nil {
+				level.Error(c.logger).Log("msg", "error reporting Time Series metrics for descriptor", "descriptor", metricType, "err", err)
+				return err
+			}
+		}
+		reportedPages++
+		if maxReached || page.NextPageToken == "" {
+			if merged != nil {
+				for _, metricDescriptor := range batch {
+					typePage, ok := merged.pages[metricDescriptor.Type]
+					if !ok {
+						continue
+					}
+					if err := c.reportTimeSeriesMetrics(typePage, metricDescriptor, ch); err != nil {
+						level.Error(c.logger).Log("msg", "error reporting Time Series metrics for descriptor", "descriptor", metricDescriptor.Type, "err", err)
+						return err
+					}
+				}
+			}
+			for metricType := range descriptors {
+				if reportedSeries[metricType] == 0 {
+					c.observeEmptyDescriptor(metricType)
+				}
+			}
+			return nil
+		}
+		timeSeriesListCall.PageToken(page.NextPageToken)
+	}
+}
+
+// splitTimeSeriesPage splits a page of Time Series by metric type. Without
+// splitting the page is returned as is, when it has any Time Series.
+func splitTimeSeriesPage(page *monitoring.ListTimeSeriesResponse, split bool) []*monitoring.ListTimeSeriesResponse {
+	if len(page.TimeSeries) == 0 {
+		return nil
+	}
+	if !split {
+		return []*monitoring.ListTimeSeriesResponse{page}
+	}
+
+	var pages []*monitoring.ListTimeSeriesResponse
+	byType := make(map[string]*monitoring.ListTimeSeriesResponse)
+	for _, timeSeries := range page.TimeSeries {
+		// Time Series without a metric can not be matched to a descriptor
+		if timeSeries.Metric == nil {
+			continue
+		}
+		typePage, ok := byType[timeSeries.Metric.Type]
+		if !ok {
+			typePage = &monitoring.ListTimeSeriesResponse{}
+			byType[timeSeries.Metric.Type] = typePage
+			pages = append(pages, typePage)
+		}
+		typePage.TimeSeries = append(typePage.TimeSeries, timeSeries)
+	}
+	return pages
+}
+
+// timeSeriesMerger merges the pages of a Time Series listing by metric type.
+// The points of a series listed on several pages are appended to its first
+// occurrence, so only its freshest point is reported.
+type timeSeriesMerger struct {
+	pages  map[string]*monitoring.ListTimeSeriesResponse
+	series map[uint64]*monitoring.TimeSeries
+}
+
+func newTimeSeriesMerger() *timeSeriesMerger {
+	return &timeSeriesMerger{
+		pages:  make(map[string]*monitoring.ListTimeSeriesResponse),
+		series: make(map[uint64]*monitoring.TimeSeries),
+	}
+}
+
+func (m *timeSeriesMerger) add(metricType string, page *monitoring.ListTimeSeriesResponse) {
+	typePage, ok := m.pages[metricType]
+	if !ok {
+		typePage = &monitoring.ListTimeSeriesResponse{}
+		m.pages[metricType] = typePage
+	}
+	for _, timeSeries := range page.TimeSeries {
+		// Time Series without a metric or resource are discarded when
+		// reported, they are not merged
+		if timeSeries.Metric == nil || timeSeries.Resource == nil {
+			typePage.TimeSeries = append(typePage.TimeSeries, timeSeries)
+			continue
+		}
+		key := timeSeriesKey(timeSeries)
+		if listed, ok := m.series[key]; ok {
+			listed.Points = append(listed.Points, timeSeries.Points...)
+			continue
+		}
+		m.series[key] = timeSeries
+		typePage.TimeSeries = append(typePage.TimeSeries, timeSeries)
+	}
+}
+
+// timeSeriesKey identifies a Time Series by its metric and monitored resource.
+func timeSeriesKey(timeSeries *monitoring.TimeSeries) uint64 {
+	var labelKeys, labelValues []string
+	for key, value := range timeSeries.Metric.Labels {
+		labelKeys = append(labelKeys, "metric."+key)
+		labelValues = append(labelValues, value)
+	}
+	for key, value := range timeSeries.Resource.Labels {
+		labelKeys = append(labelKeys, "resource."+key)
+		labelValues = append(labelValues, value)
+	}
+	return hashSeries(timeSeries.Metric.Type, timeSeries.Resource.Type, labelKeys, labelValues)
 }
 
 func (c *MonitoringCollector) reportTimeSeriesMetrics(
@@ -309,44 +2572,121 @@ func (c *MonitoringCollector) reportTimeSeriesMetrics(
 	metricDescriptor *monitoring.MetricDescriptor,
 	ch chan<- prometheus.Metric,
 ) error {
+	c.timeSeriesTotalMetric.WithLabelValues(metricDescriptor.Type).Add(float64(len(page.TimeSeries)))
+
 	var metricValue float64
 	var metricValueType prometheus.ValueType
-	var newestTSPoint *monitoring.Point
+
+	unitSuffix, unitAsLabel := "", !c.collectorDropUnitLabel && !c.collectorUnitInHelp
+	if c.collectorUnitAsSuffix {
+		if suffix, ok := utils.UnitSuffix(metricDescriptor.Unit); ok {
+			unitSuffix, unitAsLabel = suffix, false
+		}
+	}
 
 	timeSeriesMetrics := &TimeSeriesMetrics{
-		metricDescriptor:  metricDescriptor,
-		ch:                ch,
-		fillMissingLabels: c.collectorFillMissingLabels,
-		constMetrics:      make(map[string][]ConstMetric),
-		histogramMetrics:  make(map[string][]HistogramMetric),
+		namespace:          c.namespace,
+		namespaceOverride:  c.namespaceOverrideFor(metricDescriptor.Type),
+		metricDescriptor:   metricDescriptor,
+		ch:                 ch,
+		fillMissingLabels:  c.collectorFillMissingLabels,
+		unitSuffix:         unitSuffix,
+		unitInHelp:         c.collectorUnitInHelp,
+		helpMaxLength:      c.collectorHelpMaxLength,
+		helpStripNewlines:  c.collectorHelpStripNewlines,
+		counterTotalSuffix: c.collectorCounterTotalSuffix,
+		withTimestamp:      c.collectorMetricsWithTimestamp,
+		rate:               c.deltaRate(metricDescriptor),
+		accumulateDeltas:   c.deltaCounters != nil,
+		constLabels:        c.extraLabels,
+		constMetrics:       make(map[string][]ConstMetric),
+		histogramMetrics:   make(map[string][]HistogramMetric),
+		recorder:           c.otlpRecorder,
 	}
+	headersOnly := c.timeSeriesView == "HEADERS"
+	newestPageEndTime := time.Unix(0, 0)
+	defer func() {
+		c.observeNewestPoint(metricDescriptor.Type, newestPageEndTime)
+	}()
 	for _, timeSeries := range page.TimeSeries {
+		if timeSeries.Metric == nil || timeSeries.Resource == nil {
+			level.Debug(c.logger).Log("msg", "discarding Time Series without a metric or monitored resource", "metric", metricDescriptor.Type)
+			continue
+		}
+		if c.transformTimeSeries(timeSeries, metricDescriptor, ch) {
+			continue
+		}
+		metricKind, valueType := c.timeSeriesKind(timeSeries, metricDescriptor)
+		var newestTSPoint *monitoring.Point
 		newestEndTime := time.Unix(0, 0)
 		for _, point := range timeSeries.Points {
+			if point.Interval == nil {
+				continue
+			}
 			endTime, err := time.Parse(time.RFC3339Nano, point.Interval.EndTime)
 			if err != nil {
-				return fmt.Errorf("Error parsing TimeSeries Point interval end time `%s`: %s", point.Interval.EndTime, err)
+				return &PointParseError{MetricType: metricDescriptor.Type, EndTime: point.Interval.EndTime, Err: err}
 			}
 			if endTime.After(newestEndTime) {
 				newestEndTime = endTime
 				newestTSPoint = point
 			}
 		}
-		labelKeys := []string{"unit"}
-		labelValues := []string{metricDescriptor.Unit}
+		if newestEndTime.After(newestPageEndTime) {
+			newestPageEndTime = newestEndTime
+		}
+		if !headersOnly && (newestTSPoint == nil || newestTSPoint.Value == nil) {
+			level.Debug(c.logger).Log("msg", "discarding Time Series without points", "metric", metricDescriptor.Type)
+			continue
+		}
+		var labelKeys, labelValues []string
+		if unitAsLabel {
+			labelKeys = append(labelKeys, "unit")
+			labelValues = append(labelValues, metricDescriptor.Unit)
+		}
+		if c.collectorMetricTypeLabel {
+			labelKeys = append(labelKeys, "stackdriver_metric_type")
+			labelValues = append(labelValues, timeSeries.Metric.Type)
+		}
+		if c.collectorResourceTypeLabel {
+			labelKeys = append(labelKeys, "resource_type")
+			labelValues = append(labelValues, c.resourceTypeName(timeSeries.Resource.Type))
+		}
+		if c.collectorDescriptorMetadata {
+			labelKeys = append(labelKeys, "launch_stage")
+			labelValues = append(labelValues, metricDescriptor.LaunchStage)
+		}
 
-		// Add the metric labels
+		// Add the metric labels, prefixed with `metric_` if they collide
 		// @see https://cloud.google.com/monitoring/api/metrics
-		for key, value := range timeSeries.Metric.Labels {
-			labelKeys = append(labelKeys, key)
-			labelValues = append(labelValues, value)
+		metricLabels := timeSeries.Metric.Labels
+		if c.collectorFillMissingLabels && !c.collectorDropEmptyLabels {
+			metricLabels = withDescriptorLabels(metricDescriptor, metricLabels)
+		}
+		for _, key := range sortedLabelKeys(metricLabels) {
+			labelKeys, labelValues = appendLabel(labelKeys, labelValues, "metric_", key, metricLabels[key])
 		}
 
-		// Add the monitored resource labels
+		// Add the monitored resource labels, prefixed with `resource_` if they collide
 		// @see https://cloud.google.com/monitoring/api/resources
-		for key, value := range timeSeries.Resource.Labels {
-			labelKeys = append(labelKeys, key)
-			labelValues = append(labelValues, value)
+		for _, key := range sortedLabelKeys(timeSeries.Resource.Labels) {
+			labelKeys, labelValues = appendLabel(labelKeys, labelValues, "resource_", key, timeSeries.Resource.Labels[key])
+		}
+		if len(c.collectorMetadataLabels) > 0 {
+			resourceMetadataLabels, err := metadataLabels(timeSeries.Metadata)
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "discarding malformed Time Series metadata labels", "metric", metricDescriptor.Type, "err", err)
+			}
+			if c.collectorFillMissingLabels && !c.collectorDropEmptyLabels {
+				resourceMetadataLabels = withMetadataLabels(c.collectorMetadataLabels, resourceMetadataLabels)
+			}
+			for _, key := range sortedLabelKeys(resourceMetadataLabels) {
+				labelKeys, labelValues = appendLabel(labelKeys, labelValues, "", key, resourceMetadataLabels[key])
+			}
+		}
+		if region, ok := c.region(timeSeries.Resource.Labels); ok && !hasLabelKey(labelKeys, "region") {
+			labelKeys = append(labelKeys, "region")
+			labelValues = append(labelValues, region)
 		}
 
 		if c.monitoringDropDelegatedProjects {
@@ -364,7 +2704,22 @@ func (c *MonitoringCollector) reportTimeSeriesMetrics(
 			}
 		}
 
-		switch timeSeries.MetricKind {
+		labelKeys, labelValues = c.labelRules.apply(labelKeys, labelValues)
+		for i, labelValue := range labelValues {
+			labelValues[i] = utils.SanitizeLabelValue(labelValue)
+		}
+		if c.collectorDropEmptyLabels {
+			labelKeys, labelValues = dropEmptyLabels(labelKeys, labelValues)
+		}
+
+		if headersOnly {
+			// Time Series come without points in the HEADERS view, so only
+			// their presence can be reported
+			timeSeriesMetrics.CollectNewConstPresenceMetric(timeSeries, time.Now(), labelKeys, labelValues)
+			continue
+		}
+
+		switch metricKind {
 		case "GAUGE":
 			metricValueType = prometheus.GaugeValue
 		case "DELTA":
@@ -375,39 +2730,226 @@ func (c *MonitoringCollector) reportTimeSeriesMetrics(
 			continue
 		}
 
-		switch timeSeries.ValueType {
-		case "BOOL":
-			metricValue = 0
-			if *newestTSPoint.Value.BoolValue {
-				metricValue = 1
+		switch valueType {
+		case "BOOL", "INT64", "DOUBLE", "MONEY":
+			var ok bool
+			metricValue, ok = pointValue(valueType, newestTSPoint)
+			if !ok {
+				level.Debug(c.logger).Log("msg", "discarding Time Series point without value", "value_type", valueType, "metric", metricDescriptor.Type)
+				continue
+			}
+			if valueType == "MONEY" {
+				// The v3 TypedValue has no google.type.Money field with
+				// separate units and nanos: MONEY amounts come as plain
+				// DOUBLE or INT64 values, and their currency code as the unit
+				// of the descriptor, so the currency is read from there
+				if metricDescriptor.Unit == "" {
+					level.Debug(c.logger).Log("msg", "discarding MONEY Time Series without currency", "metric", metricDescriptor.Type)
+					continue
+				}
+				labelKeys, labelValues = appendLabel(labelKeys, labelValues, "metric_", "currency_code", metricDescriptor.Unit)
+			}
+			switch {
+			case metricKind == "DELTA" && c.deltaCounters != nil:
+				metricValueType = prometheus.CounterValue
+				metricValue = c.deltaCounters.Accumulate(
+					hashSeries(timeSeries.Metric.Type, timeSeries.Resource.Type, labelKeys, labelValues),
+					valueType,
+					timeSeries.Points,
+				)
+			case metricKind == "DELTA" && c.deltaPoints == "sum":
+				// CUMULATIVE points are running totals already, only DELTA
+				// points can be meaningfully added up
+				metricValue = 0
+				for _, point := range timeSeries.Points {
+					if value, ok := pointValue(valueType, point); ok {
+						metricValue += value
+					}
+				}
 			}
-		case "INT64":
-			metricValue = float64(*newestTSPoint.Value.Int64Value)
-		case "DOUBLE":
-			metricValue = *newestTSPoint.Value.DoubleValue
 		case "DISTRIBUTION":
 			dist := newestTSPoint.Value.DistributionValue
+			if dist == nil {
+				level.Debug(c.logger).Log("msg", "discarding Time Series point without value", "value_type", valueType, "metric", metricDescriptor.Type)
+				continue
+			}
+			// Histograms are cumulative, so are the counts of CUMULATIVE
+			// distributions. DELTA distributions are only turned into
+			// running totals by the accumulator.
+			count, sum := uint64(dist.Count), dist.Mean*float64(dist.Count) // Stackdriver does not provide the sum, but we can fake it
 			buckets, err := c.generateHistogramBuckets(dist)
+			if metricKind == "DELTA" && c.deltaCounters != nil {
+				metricValueType = prometheus.CounterValue
+				count, sum, buckets = c.deltaCounters.AccumulateDistribution(
+					hashSeries(timeSeries.Metric.Type, timeSeries.Resource.Type, labelKeys, labelValues),
+					timeSeries.Points,
+					c.generateHistogramBuckets,
+				)
+			}
+			if c.collectorDistributions == "mean-count" {
+				timeSeriesMetrics.CollectNewConstDistributionMeanCount(timeSeries, newestEndTime, labelKeys, metricValueType, dist.Mean, count, labelValues)
+				continue
+			}
 			if err == nil {
-				timeSeriesMetrics.CollectNewConstHistogram(timeSeries, newestEndTime, labelKeys, dist, buckets, labelValues)
+				timeSeriesMetrics.CollectNewConstHistogram(timeSeries, newestEndTime, labelKeys, count, sum, buckets, labelValues)
 			} else {
 				level.Debug(c.logger).Log("msg", "discarding", "resource", timeSeries.Resource.Type, "metric", timeSeries.Metric.Type, "err", err)
 			}
 			continue
+		case "STRING":
+			if !c.collectorStringMetricsAsInfo || newestTSPoint.Value.StringValue == nil {
+				level.Debug(c.logger).Log("msg", "discarding", "value_type", valueType, "metric", metricDescriptor.Type)
+				continue
+			}
+			labelKeys, labelValues = appendLabel(labelKeys, labelValues, "string_", "value", utils.SanitizeLabelValue(*newestTSPoint.Value.StringValue))
+			timeSeriesMetrics.CollectNewConstInfoMetric(timeSeries, newestEndTime, labelKeys, labelValues)
+			continue
 		default:
-			level.Debug(c.logger).Log("msg", "discarding", "value_type", timeSeries.ValueType, "metric", timeSeries)
+			level.Debug(c.logger).Log("msg", "discarding", "value_type", valueType, "metric", timeSeries)
 			continue
 		}
 
+		var ok bool
+		if metricValue, ok = c.finiteValue(metricValue); !ok {
+			level.Debug(c.logger).Log("msg", "discarding non-finite Time Series point value", "metric", metricDescriptor.Type)
+			continue
+		}
+		// Counters can not decrease, yet DELTA points accumulated out of
+		// order or negative CUMULATIVE points surface negative values
+		if metricValueType == prometheus.CounterValue && metricValue < 0 {
+			c.negativeCounterValuesTotalMetric.WithLabelValues(metricDescriptor.Type).Inc()
+			switch c.collectorNegativeCounterValues {
+			case "drop":
+				level.Debug(c.logger).Log("msg", "discarding negative counter value", "metric", metricDescriptor.Type, "value", metricValue)
+				continue
+			case "clamp":
+				metricValue = 0
+			}
+		}
 		timeSeriesMetrics.CollectNewConstMetric(timeSeries, newestEndTime, labelKeys, metricValueType, metricValue, labelValues)
 	}
 	timeSeriesMetrics.Complete()
 	return nil
 }
 
+// timeSeriesKind returns the metric kind and value type of a Time Series,
+// falling back to those of its descriptor when missing. A warning is logged
+// when they disagree, unless the Time Series were aligned, which changes them.
+func (c *MonitoringCollector) timeSeriesKind(timeSeries *monitoring.TimeSeries, metricDescriptor *monitoring.MetricDescriptor) (string, string) {
+	metricKind, valueType := timeSeries.MetricKind, timeSeries.ValueType
+	if metricKind == "" {
+		metricKind = metricDescriptor.MetricKind
+	}
+	if valueType == "" {
+		valueType = metricDescriptor.ValueType
+	}
+
+	if !c.aggregationFor(metricDescriptor).aligned() && (metricKind != metricDescriptor.MetricKind || valueType != metricDescriptor.ValueType) {
+		level.Warn(c.logger).Log("msg", "Time Series metric kind or value type differs from its metric descriptor, using the Time Series ones", "metric", metricDescriptor.Type, "metric_kind", metricKind, "value_type", valueType, "descriptor_metric_kind", metricDescriptor.MetricKind, "descriptor_value_type", metricDescriptor.ValueType)
+	}
+
+	return metricKind, valueType
+}
+
+// reportDescriptorMetadata reports the ingest delay and sample period of a
+// metric descriptor, when known.
+func (c *MonitoringCollector) reportDescriptorMetadata(metricDescriptor *monitoring.MetricDescriptor, ch chan<- prometheus.Metric) {
+	if metricDescriptor.Metadata == nil {
+		return
+	}
+	if ingestDelay, err := time.ParseDuration(metricDescriptor.Metadata.IngestDelay); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.metricIngestDelayDesc, prometheus.GaugeValue, ingestDelay.Seconds(), metricDescriptor.Type)
+	}
+	if samplePeriod, err := time.ParseDuration(metricDescriptor.Metadata.SamplePeriod); err == nil {
+		ch <- prometheus.MustNewConstMetric(c.metricSamplePeriodDesc, prometheus.GaugeValue, samplePeriod.Seconds(), metricDescriptor.Type)
+	}
+}
+
+// reportMetricInfo reports the properties of a metric descriptor as the labels
+// of a constant gauge, once per Metric Type rather than on every series.
+func (c *MonitoringCollector) reportMetricInfo(metricDescriptor *monitoring.MetricDescriptor, ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(
+		c.metricInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		metricDescriptor.Type,
+		metricDescriptor.Unit,
+		metricDescriptor.ValueType,
+		metricDescriptor.MetricKind,
+		metricDescriptor.LaunchStage,
+	)
+}
+
+// finiteValue handles a non-finite metric value as configured, returning
+// whether it should be reported.
+func (c *MonitoringCollector) finiteValue(value float64) (float64, bool) {
+	if !math.IsInf(value, 0) && !math.IsNaN(value) {
+		return value, true
+	}
+	switch c.collectorNonFiniteValues {
+	case "drop":
+		return value, false
+	case "clamp":
+		if math.IsNaN(value) {
+			return value, false
+		}
+		if math.IsInf(value, 1) {
+			return math.MaxFloat64, true
+		}
+		return -math.MaxFloat64, true
+	default:
+		return value, true
+	}
+}
+
+// pointValue returns the value of a BOOL, INT64, DOUBLE or MONEY point as a
+// float, and whether the point holds such a value.
+func pointValue(valueType string, point *monitoring.Point) (float64, bool) {
+	if point == nil || point.Value == nil {
+		return 0, false
+	}
+	switch valueType {
+	case "BOOL":
+		if point.Value.BoolValue == nil {
+			return 0, false
+		}
+		if *point.Value.BoolValue {
+			return 1, true
+		}
+		return 0, true
+	case "INT64":
+		if point.Value.Int64Value == nil {
+			return 0, false
+		}
+		return float64(*point.Value.Int64Value), true
+	case "DOUBLE":
+		if point.Value.DoubleValue == nil {
+			return 0, false
+		}
+		return *point.Value.DoubleValue, true
+	case "MONEY":
+		// The API has no dedicated money field with units and nanos, amounts
+		// come as plain numbers
+		if point.Value.DoubleValue != nil {
+			return *point.Value.DoubleValue, true
+		}
+		if point.Value.Int64Value != nil {
+			return float64(*point.Value.Int64Value), true
+		}
+	}
+	return 0, false
+}
+
 func (c *MonitoringCollector) generateHistogramBuckets(
 	dist *monitoring.Distribution,
 ) (map[float64]uint64, error) {
+	// Without any bucket counts, or without the bucket bounds, there is
+	// nothing to reconstruct, so only the count and sum will be reported
+	// (alongside the implicit +Inf bucket)
+	if len(dist.BucketCounts) == 0 || dist.BucketOptions == nil {
+		return map[float64]uint64{}, nil
+	}
+
 	opts := dist.BucketOptions
 	var bucketKeys []float64
 	switch {
@@ -0,0 +1,1733 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+)
+
+// newTestOptions returns the options of the default flags, collecting the
+// compute.googleapis.com/ prefix.
+func newTestOptions() *MonitoringCollectorOptions {
+	return &MonitoringCollectorOptions{
+		MetricsTypePrefixes:   []string{"compute.googleapis.com/"},
+		MetricsInterval:       5 * time.Minute,
+		Namespace:             "stackdriver",
+		Subsystem:             "monitoring",
+		LookbackMultiplier:    1,
+		FillMissingLabels:     true,
+		MetadataCacheTTL:      time.Hour,
+		ShardTotal:            1,
+		AggregateDeltasTTL:    30 * time.Minute,
+		DeltaPoints:           "newest",
+		MetricsWithTimestamp:  true,
+		Distributions:         "histogram",
+		NonFiniteValues:       "pass",
+		NegativeCounterValues: "pass",
+		DescriptorsBatchSize:  1,
+		TimeSeriesView:        "FULL",
+	}
+}
+
+// newTestCollector returns a collector configured with the default flags.
+func newTestCollector() *MonitoringCollector {
+	c, err := NewMonitoringCollector("test-project", nil, newTestOptions(), nil, log.NewNopLogger())
+	Expect(err).ToNot(HaveOccurred())
+	return c
+}
+
+var testDescriptor = &monitoring.MetricDescriptor{
+	Type:        "compute.googleapis.com/instance/cpu/utilization",
+	Description: "CPU utilization.",
+	Unit:        "1",
+	MetricKind:  "GAUGE",
+	ValueType:   "INT64",
+}
+
+func int64TimeSeries(metricLabels map[string]string, resourceLabels map[string]string, value int64) *monitoring.TimeSeries {
+	return &monitoring.TimeSeries{
+		MetricKind: "GAUGE",
+		ValueType:  "INT64",
+		Metric:     &monitoring.Metric{Type: testDescriptor.Type, Labels: metricLabels},
+		Resource:   &monitoring.MonitoredResource{Type: "gce_instance", Labels: resourceLabels},
+		Points: []*monitoring.Point{
+			{
+				Interval: &monitoring.TimeInterval{EndTime: "2020-01-01T00:00:00Z"},
+				Value:    &monitoring.TypedValue{Int64Value: &value},
+			},
+		},
+	}
+}
+
+// reportTimeSeries runs reportTimeSeriesMetrics on a page of time series and
+// returns the metrics it reported.
+func reportTimeSeries(c *MonitoringCollector, descriptor *monitoring.MetricDescriptor, timeSeries ...*monitoring.TimeSeries) []*dto.Metric {
+	ch := make(chan prometheus.Metric, 100)
+	Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{TimeSeries: timeSeries}, descriptor, ch)).To(Succeed())
+	close(ch)
+
+	var metrics []*dto.Metric
+	for metric := range ch {
+		m := &dto.Metric{}
+		Expect(metric.Write(m)).To(Succeed())
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+func metricLabels(m *dto.Metric) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range m.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+	return labels
+}
+
+var _ = Describe("generateHistogramBuckets", func() {
+	var c *MonitoringCollector
+
+	BeforeEach(func() {
+		c = &MonitoringCollector{}
+	})
+
+	It("returns cumulative buckets for explicit bounds", func() {
+		dist := &monitoring.Distribution{
+			BucketCounts: []int64{1, 2, 3},
+			BucketOptions: &monitoring.BucketOptions{
+				ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{10, 20}},
+			},
+		}
+		buckets, err := c.generateHistogramBuckets(dist)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buckets).To(Equal(map[float64]uint64{10: 1, 20: 3, math.Inf(1): 6}))
+	})
+
+	It("returns cumulative buckets for linear bounds", func() {
+		dist := &monitoring.Distribution{
+			BucketCounts: []int64{1, 1, 1},
+			BucketOptions: &monitoring.BucketOptions{
+				LinearBuckets: &monitoring.Linear{NumFiniteBuckets: 1, Offset: 0, Width: 5},
+			},
+		}
+		buckets, err := c.generateHistogramBuckets(dist)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buckets).To(Equal(map[float64]uint64{0: 1, 5: 2, math.Inf(1): 3}))
+	})
+
+	It("returns cumulative buckets for exponential bounds", func() {
+		dist := &monitoring.Distribution{
+			BucketCounts: []int64{1, 1, 1},
+			BucketOptions: &monitoring.BucketOptions{
+				ExponentialBuckets: &monitoring.Exponential{NumFiniteBuckets: 1, Scale: 1, GrowthFactor: 2},
+			},
+		}
+		buckets, err := c.generateHistogramBuckets(dist)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buckets).To(Equal(map[float64]uint64{1: 1, 2: 2, math.Inf(1): 3}))
+	})
+
+	It("returns no buckets when there are no bucket counts", func() {
+		dist := &monitoring.Distribution{
+			Count: 4,
+			Mean:  2.5,
+			BucketOptions: &monitoring.BucketOptions{
+				ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{10, 20}},
+			},
+		}
+		buckets, err := c.generateHistogramBuckets(dist)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buckets).To(BeEmpty())
+	})
+
+	It("returns no buckets when there are no bucket options", func() {
+		dist := &monitoring.Distribution{
+			Count:        4,
+			Mean:         2.5,
+			BucketCounts: []int64{1, 3},
+		}
+		buckets, err := c.generateHistogramBuckets(dist)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(buckets).To(BeEmpty())
+	})
+})
+
+var _ = Describe("requestContext", func() {
+	It("cuts off the requests to a slow server after the request timeout", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer server.Close()
+
+		service, err := monitoring.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/"))
+		Expect(err).ToNot(HaveOccurred())
+
+		c := &MonitoringCollector{requestTimeout: 50 * time.Millisecond}
+		ctx, cancel := c.requestContext(context.Background())
+		defer cancel()
+
+		begun := time.Now()
+		_, err = service.Projects.MetricDescriptors.List("projects/test-project").Context(ctx).Do()
+		Expect(err).To(MatchError(ContainSubstring("context deadline exceeded")))
+		Expect(time.Since(begun)).To(BeNumerically("<", time.Second))
+	})
+})
+
+var _ = Describe("filteredMetricsTypes", func() {
+	c := &MonitoringCollector{
+		metricsTypePrefixes: []string{"compute.googleapis.com/", "pubsub.googleapis.com/"},
+		metricsTypes:        []string{"storage.googleapis.com/api/request_count"},
+	}
+
+	It("keeps every prefix and type without filters", func() {
+		prefixes, types := c.filteredMetricsTypes(nil)
+		Expect(prefixes).To(Equal(c.metricsTypePrefixes))
+		Expect(types).To(Equal(c.metricsTypes))
+	})
+
+	It("keeps the filtered prefixes and types only", func() {
+		prefixes, types := c.filteredMetricsTypes(map[string]bool{"pubsub.googleapis.com/": true})
+		Expect(prefixes).To(Equal([]string{"pubsub.googleapis.com/"}))
+		Expect(types).To(BeEmpty())
+	})
+
+	It("ignores the filters matching nothing configured", func() {
+		prefixes, types := c.filteredMetricsTypes(map[string]bool{"logging.googleapis.com/": true})
+		Expect(prefixes).To(BeEmpty())
+		Expect(types).To(BeEmpty())
+	})
+})
+
+var _ = Describe("keepMetricType", func() {
+	It("keeps every metric type without expressions", func() {
+		c := &MonitoringCollector{}
+		Expect(c.keepMetricType("compute.googleapis.com/instance/cpu/usage_time")).To(BeTrue())
+	})
+
+	It("gives precedence to the exclude expression", func() {
+		c := &MonitoringCollector{
+			metricsTypeInclude: regexp.MustCompile("^compute.googleapis.com/instance/"),
+			metricsTypeExclude: regexp.MustCompile("/disk/"),
+		}
+		Expect(c.keepMetricType("compute.googleapis.com/instance/cpu/usage_time")).To(BeTrue())
+		Expect(c.keepMetricType("compute.googleapis.com/instance/disk/read_bytes_count")).To(BeFalse())
+		Expect(c.keepMetricType("compute.googleapis.com/firewall/dropped_bytes_count")).To(BeFalse())
+	})
+})
+
+var _ = Describe("keepMonitoredResourceTypes", func() {
+	c := &MonitoringCollector{monitoredResourceTypes: map[string]bool{"k8s_container": true}}
+
+	It("keeps descriptors listed for a monitored resource type to collect", func() {
+		Expect(c.keepMonitoredResourceTypes(&monitoring.MetricDescriptor{MonitoredResourceTypes: []string{"k8s_pod", "k8s_container"}})).To(BeTrue())
+		Expect(c.keepMonitoredResourceTypes(&monitoring.MetricDescriptor{MonitoredResourceTypes: []string{"gce_instance"}})).To(BeFalse())
+	})
+
+	It("keeps descriptors without monitored resource types", func() {
+		Expect(c.keepMonitoredResourceTypes(&monitoring.MetricDescriptor{})).To(BeTrue())
+	})
+})
+
+var _ = Describe("aggregationFor", func() {
+	c := &MonitoringCollector{
+		metricsInterval: 5 * time.Minute,
+		deltaRates:      true,
+		aggregation:     aggregation{alignmentPeriod: time.Minute, perSeriesAligner: "ALIGN_MEAN"},
+	}
+
+	It("aligns numeric DELTA metrics as rates over the metrics interval", func() {
+		a := c.aggregationFor(&monitoring.MetricDescriptor{MetricKind: "DELTA", ValueType: "INT64"})
+		Expect(a).To(Equal(rateAggregation(5 * time.Minute)))
+		Expect(a.validate()).To(Succeed())
+	})
+
+	It("does not align other metrics as rates", func() {
+		Expect(c.aggregationFor(&monitoring.MetricDescriptor{MetricKind: "CUMULATIVE", ValueType: "INT64"})).To(Equal(c.aggregation))
+		Expect(c.aggregationFor(&monitoring.MetricDescriptor{MetricKind: "DELTA", ValueType: "DISTRIBUTION"})).To(Equal(c.aggregation))
+	})
+})
+
+var _ = Describe("parseNamespaceOverrides", func() {
+	It("parses the namespace and optional subsystem of each prefix", func() {
+		overrides, err := parseNamespaceOverrides([]string{"pubsub.googleapis.com/:gcp_pubsub", "compute.googleapis.com/:gcp:compute"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(overrides).To(HaveKeyWithValue("pubsub.googleapis.com/", &namespaceOverride{prefix: "pubsub.googleapis.com/", namespace: "gcp_pubsub"}))
+		Expect(overrides).To(HaveKeyWithValue("compute.googleapis.com/", &namespaceOverride{prefix: "compute.googleapis.com/", namespace: "gcp", subsystem: "compute", hasSubsystem: true}))
+	})
+
+	It("rejects invalid namespaces", func() {
+		_, err := parseNamespaceOverrides([]string{"pubsub.googleapis.com/:gcp-pubsub"})
+		Expect(err).To(MatchError(ContainSubstring(`invalid namespace or subsystem "gcp-pubsub"`)))
+	})
+})
+
+var _ = Describe("keepMetricKind", func() {
+	It("keeps every metric kind by default", func() {
+		c := &MonitoringCollector{}
+		Expect(c.keepMetricKind(&monitoring.MetricDescriptor{MetricKind: "GAUGE"})).To(BeTrue())
+	})
+
+	It("keeps only the metric kinds to collect", func() {
+		c := &MonitoringCollector{metricKinds: map[string]bool{"CUMULATIVE": true}}
+		Expect(c.keepMetricKind(&monitoring.MetricDescriptor{MetricKind: "CUMULATIVE"})).To(BeTrue())
+		Expect(c.keepMetricKind(&monitoring.MetricDescriptor{MetricKind: "GAUGE"})).To(BeFalse())
+	})
+})
+
+var _ = Describe("inShard", func() {
+	metricTypes := []string{
+		"compute.googleapis.com/instance/cpu/usage_time",
+		"compute.googleapis.com/instance/cpu/utilization",
+		"compute.googleapis.com/instance/disk/read_bytes_count",
+		"compute.googleapis.com/instance/uptime",
+		"pubsub.googleapis.com/subscription/num_undelivered_messages",
+	}
+
+	It("keeps every metric type without sharding", func() {
+		c := &MonitoringCollector{shardTotal: 1}
+		for _, metricType := range metricTypes {
+			Expect(c.inShard(metricType)).To(BeTrue())
+		}
+	})
+
+	It("keeps every metric type in exactly one shard", func() {
+		for _, metricType := range metricTypes {
+			shards := 0
+			for index := 0; index < 3; index++ {
+				c := &MonitoringCollector{shardIndex: index, shardTotal: 3}
+				if c.inShard(metricType) {
+					shards++
+				}
+			}
+			Expect(shards).To(Equal(1), metricType)
+		}
+	})
+})
+
+var _ = Describe("jumpHash", func() {
+	It("only moves keys to the new bucket when adding one", func() {
+		for key := uint64(0); key < 1000; key++ {
+			before, after := jumpHash(key, 4), jumpHash(key, 5)
+			Expect(after == before || after == 4).To(BeTrue())
+		}
+	})
+})
+
+var _ = Describe("collapsePrefixes", func() {
+	It("drops the prefixes covered by another one", func() {
+		Expect(collapsePrefixes([]string{
+			"compute.googleapis.com/instance/",
+			"pubsub.googleapis.com/",
+			"compute.googleapis.com/",
+			"compute.googleapis.com/firewall/",
+		})).To(Equal([]string{"pubsub.googleapis.com/", "compute.googleapis.com/"}))
+	})
+
+	It("keeps a single copy of repeated prefixes", func() {
+		Expect(collapsePrefixes([]string{"compute.googleapis.com/", "compute.googleapis.com/"})).To(Equal([]string{"compute.googleapis.com/"}))
+	})
+
+	It("keeps no prefixes", func() {
+		Expect(collapsePrefixes(nil)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("dropScrapedDescriptors", func() {
+	It("drops the metric types already scraped by another prefix", func() {
+		var scrapedTypes sync.Map
+		first := map[string]*monitoring.MetricDescriptor{
+			"compute.googleapis.com/instance/cpu/usage_time":      {},
+			"compute.googleapis.com/firewall/dropped_bytes_count": {},
+		}
+		second := map[string]*monitoring.MetricDescriptor{
+			"compute.googleapis.com/instance/cpu/usage_time":        {},
+			"compute.googleapis.com/instance/disk/read_bytes_count": {},
+		}
+
+		dropScrapedDescriptors(&scrapedTypes, first)
+		dropScrapedDescriptors(&scrapedTypes, second)
+		Expect(first).To(HaveLen(2))
+		Expect(second).To(HaveLen(1))
+		Expect(second).To(HaveKey("compute.googleapis.com/instance/disk/read_bytes_count"))
+	})
+})
+
+var _ = Describe("observeEmptyDescriptor", func() {
+	It("skips the metric types without Time Series during the cooldown", func() {
+		c := newTestCollector()
+		Expect(c.inEmptyCooldown(testDescriptor.Type)).To(BeFalse())
+
+		c.observeEmptyDescriptor(testDescriptor.Type)
+		Expect(c.inEmptyCooldown(testDescriptor.Type)).To(BeFalse())
+
+		c.emptyDescriptors = newDescriptorCache(time.Hour)
+		c.observeEmptyDescriptor(testDescriptor.Type)
+		Expect(c.inEmptyCooldown(testDescriptor.Type)).To(BeTrue())
+		Expect(c.inEmptyCooldown("compute.googleapis.com/instance/disk/read_bytes_count")).To(BeFalse())
+
+		m := &dto.Metric{}
+		Expect(c.emptyDescriptorsTotalMetric.WithLabelValues(testDescriptor.Type).Write(m)).To(Succeed())
+		Expect(m.GetCounter().GetValue()).To(Equal(float64(2)))
+	})
+})
+
+var _ = Describe("limitDescriptors", func() {
+	var descriptors map[string]*monitoring.MetricDescriptor
+
+	BeforeEach(func() {
+		descriptors = make(map[string]*monitoring.MetricDescriptor)
+		for _, metricType := range []string{"compute.googleapis.com/c", "compute.googleapis.com/a", "compute.googleapis.com/b"} {
+			descriptors[metricType] = &monitoring.MetricDescriptor{Type: metricType}
+		}
+	})
+
+	It("keeps every descriptor without a max", func() {
+		c := &MonitoringCollector{logger: log.NewNopLogger()}
+		c.limitDescriptors(descriptors)
+		Expect(descriptors).To(HaveLen(3))
+	})
+
+	It("keeps the first descriptors in Metric Type order", func() {
+		c := &MonitoringCollector{maxDescriptorsPerPrefix: 2, logger: log.NewNopLogger()}
+		c.limitDescriptors(descriptors)
+		Expect(descriptors).To(HaveLen(2))
+		Expect(descriptors).To(HaveKey("compute.googleapis.com/a"))
+		Expect(descriptors).To(HaveKey("compute.googleapis.com/b"))
+	})
+})
+
+var _ = Describe("limitTimeSeries", func() {
+	var c *MonitoringCollector
+	var page *monitoring.ListTimeSeriesResponse
+
+	BeforeEach(func() {
+		c = newTestCollector()
+		page = &monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{{}, {}, {}},
+		}
+	})
+
+	It("keeps every series without a max", func() {
+		Expect(c.limitTimeSeries(testDescriptor.Type, page, 10)).To(BeFalse())
+		Expect(page.TimeSeries).To(HaveLen(3))
+	})
+
+	It("drops the series exceeding the max", func() {
+		c.maxSeriesPerMetricType = 4
+		Expect(c.limitTimeSeries(testDescriptor.Type, page, 0)).To(BeFalse())
+		Expect(page.TimeSeries).To(HaveLen(3))
+
+		Expect(c.limitTimeSeries(testDescriptor.Type, page, 3)).To(BeTrue())
+		Expect(page.TimeSeries).To(HaveLen(1))
+
+		m := &dto.Metric{}
+		Expect(c.seriesDroppedTotalMetric.WithLabelValues(testDescriptor.Type).Write(m)).To(Succeed())
+		Expect(m.GetCounter().GetValue()).To(Equal(float64(2)))
+	})
+})
+
+var _ = Describe("timeSeriesInterval", func() {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	It("ends now without an offset", func() {
+		c := &MonitoringCollector{metricsInterval: 5 * time.Minute}
+		startTime, endTime := c.timeSeriesInterval(testDescriptor.Type, now)
+		Expect(startTime).To(Equal(now.Add(-5 * time.Minute)))
+		Expect(endTime).To(Equal(now))
+	})
+
+	It("shifts the interval by the offset", func() {
+		c := &MonitoringCollector{metricsInterval: 5 * time.Minute, metricsOffset: 2 * time.Minute}
+		startTime, endTime := c.timeSeriesInterval(testDescriptor.Type, now)
+		Expect(startTime).To(Equal(now.Add(-7 * time.Minute)))
+		Expect(endTime).To(Equal(now.Add(-2 * time.Minute)))
+	})
+
+	It("looks back a multiple of the interval", func() {
+		c := &MonitoringCollector{metricsInterval: 5 * time.Minute, lookbackMultiplier: 2.5}
+		startTime, endTime := c.timeSeriesInterval(testDescriptor.Type, now)
+		Expect(startTime).To(Equal(now.Add(-12*time.Minute - 30*time.Second)))
+		Expect(endTime).To(Equal(now))
+	})
+
+	It("uses the fixed interval as is", func() {
+		c := &MonitoringCollector{
+			metricsInterval:    5 * time.Minute,
+			metricsOffset:      2 * time.Minute,
+			fixedIntervalStart: now.Add(-24 * time.Hour),
+			fixedIntervalEnd:   now.Add(-23 * time.Hour),
+		}
+		startTime, endTime := c.timeSeriesInterval(testDescriptor.Type, now)
+		Expect(startTime).To(Equal(now.Add(-24 * time.Hour)))
+		Expect(endTime).To(Equal(now.Add(-23 * time.Hour)))
+	})
+})
+
+var _ = Describe("timeSeriesMerger", func() {
+	It("merges the points of the series listed on several pages", func() {
+		first := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		other := int64TimeSeries(nil, map[string]string{"instance_id": "2"}, 2)
+		second := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 3)
+		second.Points[0].Interval.EndTime = "2020-01-01T00:05:00Z"
+
+		merger := newTimeSeriesMerger()
+		merger.add(testDescriptor.Type, &monitoring.ListTimeSeriesResponse{TimeSeries: []*monitoring.TimeSeries{first, other}})
+		merger.add(testDescriptor.Type, &monitoring.ListTimeSeriesResponse{TimeSeries: []*monitoring.TimeSeries{second}})
+
+		page := merger.pages[testDescriptor.Type]
+		Expect(page.TimeSeries).To(HaveLen(2))
+		Expect(page.TimeSeries[0].Points).To(HaveLen(2))
+
+		values := make(map[string]float64)
+		for _, metric := range reportTimeSeries(newTestCollector(), testDescriptor, page.TimeSeries...) {
+			values[metricLabels(metric)["instance_id"]] = metric.GetGauge().GetValue()
+		}
+		Expect(values).To(Equal(map[string]float64{"1": 3, "2": 2}))
+	})
+
+	It("tells apart the series by their labels and monitored resource", func() {
+		metricLabel := int64TimeSeries(map[string]string{"id": "1"}, nil, 1)
+		resourceLabel := int64TimeSeries(nil, map[string]string{"id": "1"}, 2)
+
+		merger := newTimeSeriesMerger()
+		merger.add(testDescriptor.Type, &monitoring.ListTimeSeriesResponse{TimeSeries: []*monitoring.TimeSeries{metricLabel, resourceLabel}})
+		Expect(merger.pages[testDescriptor.Type].TimeSeries).To(HaveLen(2))
+	})
+})
+
+var _ = Describe("descriptorTimeSeriesFilter", func() {
+	c := &MonitoringCollector{
+		resourceTypes: map[string][]string{
+			"compute.googleapis.com/": {"gce_instance", "gce_disk", "k8s_node"},
+		},
+	}
+
+	It("restricts the filter to the resource types the descriptor is listed for", func() {
+		descriptor := &monitoring.MetricDescriptor{
+			Type:                   "compute.googleapis.com/instance/cpu/usage_time",
+			MonitoredResourceTypes: []string{"gce_instance", "k8s_node"},
+		}
+		Expect(c.descriptorTimeSeriesFilter(descriptor)).To(Equal(
+			`metric.type="compute.googleapis.com/instance/cpu/usage_time" AND (resource.type="gce_instance" OR resource.type="k8s_node")`,
+		))
+	})
+
+	It("skips descriptors listed for none of the resource types", func() {
+		_, ok := c.resourceTypesFor(&monitoring.MetricDescriptor{
+			Type:                   "compute.googleapis.com/firewall/dropped_bytes_count",
+			MonitoredResourceTypes: []string{"gce_firewall"},
+		})
+		Expect(ok).To(BeFalse())
+	})
+
+	It("does not restrict the descriptors of other prefixes", func() {
+		descriptor := &monitoring.MetricDescriptor{Type: "pubsub.googleapis.com/topic/send_request_count"}
+		Expect(c.descriptorTimeSeriesFilter(descriptor)).To(Equal(`metric.type="pubsub.googleapis.com/topic/send_request_count"`))
+	})
+})
+
+var _ = Describe("timeSeriesFilter", func() {
+	It("filters by metric type", func() {
+		c := &MonitoringCollector{}
+		Expect(c.timeSeriesFilter("compute.googleapis.com/instance/cpu/usage_time")).To(Equal(`metric.type="compute.googleapis.com/instance/cpu/usage_time"`))
+	})
+
+	It("adds the filters of the matching prefixes", func() {
+		c := &MonitoringCollector{
+			metricsFilters: map[string]string{
+				"compute.googleapis.com/":          `resource.labels.zone="us-central1-a"`,
+				"compute.googleapis.com/instance/": `metric.labels.instance_name="test"`,
+				"pubsub.googleapis.com/":           `resource.labels.topic_id="test"`,
+			},
+		}
+		Expect(c.timeSeriesFilter("compute.googleapis.com/instance/cpu/usage_time")).To(Equal(
+			`metric.type="compute.googleapis.com/instance/cpu/usage_time" AND (resource.labels.zone="us-central1-a") AND (metric.labels.instance_name="test")`,
+		))
+	})
+})
+
+var _ = Describe("batchDescriptors", func() {
+	descriptors := map[string]*monitoring.MetricDescriptor{
+		"compute.googleapis.com/instance/cpu/usage_time":         {Type: "compute.googleapis.com/instance/cpu/usage_time"},
+		"compute.googleapis.com/instance/cpu/utilization":        {Type: "compute.googleapis.com/instance/cpu/utilization"},
+		"compute.googleapis.com/instance/disk/read_bytes_count":  {Type: "compute.googleapis.com/instance/disk/read_bytes_count"},
+		"compute.googleapis.com/instance/disk/write_bytes_count": {Type: "compute.googleapis.com/instance/disk/write_bytes_count"},
+	}
+
+	It("requests each descriptor on its own without batching", func() {
+		c := &MonitoringCollector{descriptorsBatchSize: 1}
+		Expect(c.batchDescriptors(descriptors)).To(HaveLen(4))
+	})
+
+	It("groups the descriptors up to the batch size in Metric Type order", func() {
+		c := &MonitoringCollector{descriptorsBatchSize: 3}
+		batches := c.batchDescriptors(descriptors)
+		Expect(batches).To(HaveLen(2))
+		Expect(batchTypes(batches[0])).To(Equal("compute.googleapis.com/instance/cpu/usage_time,compute.googleapis.com/instance/cpu/utilization,compute.googleapis.com/instance/disk/read_bytes_count"))
+		Expect(batchTypes(batches[1])).To(Equal("compute.googleapis.com/instance/disk/write_bytes_count"))
+	})
+
+	It("does not group descriptors with different filters", func() {
+		c := &MonitoringCollector{
+			descriptorsBatchSize: 10,
+			metricsFilters: map[string]string{
+				"compute.googleapis.com/instance/disk/": `resource.labels.zone="us-central1-a"`,
+			},
+		}
+		batches := c.batchDescriptors(descriptors)
+		Expect(batches).To(HaveLen(2))
+		Expect(batchTypes(batches[0])).To(Equal("compute.googleapis.com/instance/cpu/usage_time,compute.googleapis.com/instance/cpu/utilization"))
+		Expect(c.batchTimeSeriesFilter(batches[1])).To(Equal(
+			`metric.type = one_of("compute.googleapis.com/instance/disk/read_bytes_count", "compute.googleapis.com/instance/disk/write_bytes_count") AND (resource.labels.zone="us-central1-a")`,
+		))
+	})
+})
+
+var _ = Describe("splitTimeSeriesPage", func() {
+	It("splits the Time Series of a batch by metric type", func() {
+		page := &monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{
+				{Metric: &monitoring.Metric{Type: "a"}},
+				{Metric: &monitoring.Metric{Type: "b"}},
+				{Metric: &monitoring.Metric{Type: "a"}},
+			},
+			NextPageToken: "next",
+		}
+		pages := splitTimeSeriesPage(page, true)
+		Expect(pages).To(HaveLen(2))
+		Expect(pages[0].TimeSeries).To(HaveLen(2))
+		Expect(pages[0].NextPageToken).To(BeEmpty())
+		Expect(pages[1].TimeSeries).To(HaveLen(1))
+	})
+
+	It("drops the Time Series without a metric when splitting", func() {
+		page := &monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{
+				{Metric: nil},
+				{Metric: &monitoring.Metric{Type: "a"}},
+			},
+		}
+		pages := splitTimeSeriesPage(page, true)
+		Expect(pages).To(HaveLen(1))
+		Expect(pages[0].TimeSeries).To(HaveLen(1))
+	})
+})
+
+var _ = Describe("reportTimeSeriesMetrics", func() {
+	var c *MonitoringCollector
+
+	BeforeEach(func() {
+		c = newTestCollector()
+	})
+
+	It("reports the newest point of DELTA metrics, or the sum of their points when enabled", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.MetricKind = "DELTA"
+		timeSeries.Points = []*monitoring.Point{
+			deltaPoint("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z", 2),
+			deltaPoint("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z", 1),
+		}
+
+		c.deltaPoints = "newest"
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(2)))
+
+		c.deltaPoints = "sum"
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(3)))
+	})
+
+	It("stamps the metrics with the end time of their point when enabled", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+
+		c.collectorMetricsWithTimestamp = true
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetTimestampMs()).To(Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)))
+
+		c.collectorMetricsWithTimestamp = false
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].TimestampMs).To(BeNil())
+	})
+
+	It("discards time series without points", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		timeSeries.Points = nil
+		Expect(reportTimeSeries(c, testDescriptor, timeSeries)).To(BeEmpty())
+	})
+
+	It("discards time series without a metric", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		timeSeries.Metric = nil
+		Expect(reportTimeSeries(c, testDescriptor, timeSeries)).To(BeEmpty())
+	})
+
+	It("discards time series without a monitored resource", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		timeSeries.Resource = nil
+		Expect(reportTimeSeries(c, testDescriptor, timeSeries)).To(BeEmpty())
+	})
+
+	It("discards time series without a point value", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		timeSeries.Points[0].Value.Int64Value = nil
+		Expect(reportTimeSeries(c, testDescriptor, timeSeries)).To(BeEmpty())
+	})
+
+	It("returns a PointParseError for malformed point end times", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		timeSeries.Points[0].Interval.EndTime = "yesterday"
+
+		err := c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{timeSeries},
+		}, testDescriptor, make(chan prometheus.Metric, 1))
+		var parseErr *PointParseError
+		Expect(errors.As(err, &parseErr)).To(BeTrue())
+		Expect(parseErr.MetricType).To(Equal(testDescriptor.Type))
+		Expect(parseErr.EndTime).To(Equal("yesterday"))
+	})
+
+	It("does not reuse the point of a previous time series", func() {
+		empty := int64TimeSeries(nil, map[string]string{"instance_id": "2"}, 2)
+		empty.Points = nil
+		metrics := reportTimeSeries(c, testDescriptor, int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1), empty)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("reports MONEY amounts with the currency of the descriptor unit", func() {
+		descriptor := *testDescriptor
+		descriptor.ValueType = "MONEY"
+		descriptor.Unit = "USD"
+		amount := 12.5
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.ValueType = "MONEY"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{DoubleValue: &amount}
+
+		metrics := reportTimeSeries(c, &descriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(12.5))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("currency_code", "USD"))
+	})
+
+	It("reports MONEY amounts sent as INT64 values", func() {
+		descriptor := *testDescriptor
+		descriptor.ValueType = "MONEY"
+		descriptor.Unit = "EUR"
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 3)
+		timeSeries.ValueType = "MONEY"
+
+		metrics := reportTimeSeries(c, &descriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(3)))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("currency_code", "EUR"))
+	})
+
+	It("discards MONEY series whose descriptor has no currency unit", func() {
+		descriptor := *testDescriptor
+		descriptor.ValueType = "MONEY"
+		descriptor.Unit = ""
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 3)
+		timeSeries.ValueType = "MONEY"
+
+		Expect(reportTimeSeries(c, &descriptor, timeSeries)).To(BeEmpty())
+	})
+
+	It("reports the unit label unless dropped, and never a resource_type label", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(Equal(map[string]string{"unit": "1", "instance_id": "1"}))
+		Expect(metricLabels(metrics[0])).ToNot(HaveKey("resource_type"))
+
+		c.collectorDropUnitLabel = true
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(Equal(map[string]string{"instance_id": "1"}))
+	})
+
+	It("reports the original metric type as a label when enabled", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).ToNot(HaveKey("stackdriver_metric_type"))
+
+		c.collectorMetricTypeLabel = true
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("stackdriver_metric_type", "compute.googleapis.com/instance/cpu/utilization"))
+	})
+
+	It("reports the launch stage of the descriptor as a label when enabled", func() {
+		descriptor := *testDescriptor
+		descriptor.LaunchStage = "BETA"
+		c.collectorDescriptorMetadata = true
+
+		metrics := reportTimeSeries(c, &descriptor, int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1))
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("launch_stage", "BETA"))
+	})
+
+	It("prefixes colliding label keys", func() {
+		metrics := reportTimeSeries(c, testDescriptor, int64TimeSeries(
+			map[string]string{"unit": "core", "zone": "us-central1-a"},
+			map[string]string{"zone": "us-central1-b", "instance_id": "1"},
+			1,
+		))
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(Equal(map[string]string{
+			"unit":          "1",
+			"metric_unit":   "core",
+			"zone":          "us-central1-a",
+			"resource_zone": "us-central1-b",
+			"instance_id":   "1",
+		}))
+	})
+
+	It("sanitizes the label values", func() {
+		metrics := reportTimeSeries(c, testDescriptor, int64TimeSeries(
+			map[string]string{"state": "run\nning\xff"},
+			map[string]string{"instance_id": "1"},
+			1,
+		))
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("state", "running\uFFFD"))
+	})
+
+	It("reports STRING metrics as info metrics when enabled", func() {
+		value := "RUNNING"
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.ValueType = "STRING"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{StringValue: &value}
+
+		Expect(reportTimeSeries(c, testDescriptor, timeSeries)).To(BeEmpty())
+
+		c.collectorStringMetricsAsInfo = true
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(1)))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("value", "RUNNING"))
+	})
+
+	It("reports the count and sum of DISTRIBUTION metrics without bucket options", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.ValueType = "DISTRIBUTION"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{
+			Count:        4,
+			Mean:         2.5,
+			BucketCounts: []int64{1, 3},
+		}}
+
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetHistogram().GetSampleCount()).To(Equal(uint64(4)))
+		Expect(metrics[0].GetHistogram().GetSampleSum()).To(Equal(float64(10)))
+		Expect(metrics[0].GetHistogram().GetBucket()).To(BeEmpty())
+	})
+
+	It("reports the count of CUMULATIVE DISTRIBUTION metrics as a counter", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.MetricKind = "CUMULATIVE"
+		timeSeries.ValueType = "DISTRIBUTION"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{Count: 4, Mean: 2.5}}
+
+		c.collectorDistributions = "mean-count"
+		counters := 0
+		for _, metric := range reportTimeSeries(c, testDescriptor, timeSeries) {
+			if metric.GetCounter() != nil {
+				Expect(metric.GetCounter().GetValue()).To(Equal(float64(4)))
+				counters++
+			}
+		}
+		Expect(counters).To(Equal(1))
+	})
+
+	It("adds up the DELTA DISTRIBUTION points across scrapes when aggregating deltas", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.MetricKind = "DELTA"
+		timeSeries.ValueType = "DISTRIBUTION"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{
+			Count:         4,
+			Mean:          2.5,
+			BucketCounts:  []int64{1, 3},
+			BucketOptions: &monitoring.BucketOptions{ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{2}}},
+		}}
+
+		c.deltaCounters = newDeltaCounterStore(time.Hour, 0)
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetHistogram().GetSampleCount()).To(Equal(uint64(4)))
+
+		// The same point is not counted twice, a new one is added up
+		Expect(reportTimeSeries(c, testDescriptor, timeSeries)[0].GetHistogram().GetSampleCount()).To(Equal(uint64(4)))
+		timeSeries.Points[0].Interval.EndTime = "2020-01-01T00:01:00Z"
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics[0].GetHistogram().GetSampleCount()).To(Equal(uint64(8)))
+		Expect(metrics[0].GetHistogram().GetSampleSum()).To(Equal(float64(20)))
+		Expect(metrics[0].GetHistogram().GetBucket()[0].GetCumulativeCount()).To(Equal(uint64(2)))
+	})
+
+	It("reports DISTRIBUTION metrics as mean and count when enabled", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.ValueType = "DISTRIBUTION"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{Count: 4, Mean: 2.5}}
+
+		c.collectorDistributions = "mean-count"
+		ch := make(chan prometheus.Metric, 2)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{timeSeries},
+		}, testDescriptor, ch)).To(Succeed())
+		close(ch)
+
+		values := make(map[string]float64)
+		for metric := range ch {
+			m := &dto.Metric{}
+			Expect(metric.Write(m)).To(Succeed())
+			Expect(m.GetHistogram()).To(BeNil())
+			values[metric.Desc().String()] = m.GetGauge().GetValue()
+		}
+		Expect(values).To(HaveLen(2))
+		for desc, value := range values {
+			switch {
+			case regexp.MustCompile(`_mean"`).MatchString(desc):
+				Expect(value).To(Equal(2.5))
+			case regexp.MustCompile(`_count"`).MatchString(desc):
+				Expect(value).To(Equal(float64(4)))
+			default:
+				Fail("unexpected metric " + desc)
+			}
+		}
+	})
+
+	It("derives the region label from the region label sources when enabled", func() {
+		c.collectorRegionLabelSources = []string{"zone", "location"}
+		metrics := reportTimeSeries(c, testDescriptor,
+			int64TimeSeries(nil, map[string]string{"instance_id": "1", "zone": "us-central1-a"}, 1),
+			int64TimeSeries(nil, map[string]string{"instance_id": "2", "location": "europe-west1"}, 1),
+		)
+		Expect(metrics).To(HaveLen(2))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("region", "us-central1"))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("zone", "us-central1-a"))
+		Expect(metricLabels(metrics[1])).To(HaveKeyWithValue("region", "europe-west1"))
+	})
+
+	It("reports the resource type label renamed when enabled", func() {
+		c.resourceTypeNames = map[string]string{"gce_instance": "vm"}
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).ToNot(HaveKey("resource_type"))
+
+		c.collectorResourceTypeLabel = true
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("resource_type", "vm"))
+
+		timeSeries.Resource.Type = "k8s_node"
+		metrics = reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("resource_type", "k8s_node"))
+	})
+
+	It("reports the labels of the descriptor missing from a series in a stable order", func() {
+		descriptor := *testDescriptor
+		descriptor.Labels = []*monitoring.LabelDescriptor{{Key: "state"}, {Key: "instance_name"}}
+
+		for i := 0; i < 2; i++ {
+			ch := make(chan prometheus.Metric, 1)
+			Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+				TimeSeries: []*monitoring.TimeSeries{int64TimeSeries(
+					map[string]string{"state": "running"},
+					map[string]string{"zone": "us-central1-a", "instance_id": "1"},
+					1,
+				)},
+			}, &descriptor, ch)).To(Succeed())
+			metric := <-ch
+			Expect(metric.Desc().String()).To(ContainSubstring("variableLabels: [unit instance_name state instance_id zone]"))
+
+			m := &dto.Metric{}
+			Expect(metric.Write(m)).To(Succeed())
+			Expect(metricLabels(m)).To(HaveKeyWithValue("instance_name", ""))
+		}
+	})
+
+	It("reports the metadata labels, empty when missing", func() {
+		withMetadata := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		withMetadata.Metadata = &monitoring.MonitoredResourceMetadata{
+			SystemLabels: []byte(`{"machine_type":"n1-standard-1"}`),
+			UserLabels:   map[string]string{"env": "prod"},
+		}
+		withoutMetadata := int64TimeSeries(nil, map[string]string{"instance_id": "2"}, 1)
+
+		c.collectorMetadataLabels = []string{"system_labels.machine_type", "user_labels.env"}
+		metrics := reportTimeSeries(c, testDescriptor, withMetadata, withoutMetadata)
+		Expect(metrics).To(HaveLen(2))
+		for _, metric := range metrics {
+			labels := metricLabels(metric)
+			if labels["instance_id"] == "1" {
+				Expect(labels).To(HaveKeyWithValue("metadata_system_machine_type", "n1-standard-1"))
+				Expect(labels).To(HaveKeyWithValue("metadata_user_env", "prod"))
+			} else {
+				Expect(labels).To(HaveKeyWithValue("metadata_system_machine_type", ""))
+				Expect(labels).To(HaveKeyWithValue("metadata_user_env", ""))
+			}
+		}
+	})
+
+	It("reports the unit in the help instead of a label when enabled", func() {
+		c.collectorUnitInHelp = true
+		ch := make(chan prometheus.Metric, 1)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)},
+		}, testDescriptor, ch)).To(Succeed())
+		metric := <-ch
+		Expect(metric.Desc().String()).To(ContainSubstring(`help: "CPU utilization. (unit: 1)"`))
+
+		m := &dto.Metric{}
+		Expect(metric.Write(m)).To(Succeed())
+		Expect(metricLabels(m)).ToNot(HaveKey("unit"))
+	})
+
+	It("reports a default help for descriptors without description", func() {
+		descriptor := *testDescriptor
+		descriptor.Description = ""
+		ch := make(chan prometheus.Metric, 1)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)},
+		}, &descriptor, ch)).To(Succeed())
+		Expect((<-ch).Desc().String()).To(ContainSubstring(`help: "Google Stackdriver Monitoring metric compute.googleapis.com/instance/cpu/utilization."`))
+	})
+
+	It("strips the newlines of the help and truncates it when enabled", func() {
+		descriptor := *testDescriptor
+		descriptor.Description = "CPU utilization.\n\nIt is sampled every minute."
+		c.collectorHelpStripNewlines = true
+		c.collectorHelpMaxLength = 26
+		ch := make(chan prometheus.Metric, 1)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)},
+		}, &descriptor, ch)).To(Succeed())
+		Expect((<-ch).Desc().String()).To(ContainSubstring(`help: "CPU utilization. It is sam"`))
+	})
+
+	It("uses the kind and value type of the time series over the descriptor ones", func() {
+		descriptor := *testDescriptor
+		descriptor.MetricKind = "GAUGE"
+		descriptor.ValueType = "DOUBLE"
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 3)
+		timeSeries.MetricKind = "CUMULATIVE"
+
+		metrics := reportTimeSeries(c, &descriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetCounter().GetValue()).To(Equal(float64(3)))
+	})
+
+	It("appends _total to the name of counters when enabled", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		timeSeries.MetricKind = "CUMULATIVE"
+		c.collectorCounterTotalSuffix = true
+		ch := make(chan prometheus.Metric, 1)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{timeSeries},
+		}, testDescriptor, ch)).To(Succeed())
+		Expect((<-ch).Desc().String()).To(ContainSubstring(`fqName: "stackdriver_gce_instance_compute_googleapis_com_instance_cpu_utilization_total"`))
+	})
+
+	It("uses the namespace override of the metric type prefix", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		c.namespaceOverrides = map[string]*namespaceOverride{
+			"compute.googleapis.com/": {prefix: "compute.googleapis.com/", namespace: "gcp_compute"},
+		}
+		ch := make(chan prometheus.Metric, 1)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{timeSeries},
+		}, testDescriptor, ch)).To(Succeed())
+		Expect((<-ch).Desc().String()).To(ContainSubstring(`fqName: "gcp_compute_gce_instance_instance_cpu_utilization"`))
+
+		c.namespaceOverrides["compute.googleapis.com/instance/"] = &namespaceOverride{prefix: "compute.googleapis.com/instance/", namespace: "gcp_compute", hasSubsystem: true, subsystem: "instance"}
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{timeSeries},
+		}, testDescriptor, ch)).To(Succeed())
+		Expect((<-ch).Desc().String()).To(ContainSubstring(`fqName: "gcp_compute_instance_cpu_utilization"`))
+	})
+
+	It("reports DELTA rates as _rate gauges when enabled", func() {
+		descriptor := *testDescriptor
+		descriptor.MetricKind = "DELTA"
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+		c.deltaRates = true
+		ch := make(chan prometheus.Metric, 1)
+		Expect(c.reportTimeSeriesMetrics(&monitoring.ListTimeSeriesResponse{
+			TimeSeries: []*monitoring.TimeSeries{timeSeries},
+		}, &descriptor, ch)).To(Succeed())
+		Expect((<-ch).Desc().String()).To(ContainSubstring(`fqName: "stackdriver_gce_instance_compute_googleapis_com_instance_cpu_utilization_rate"`))
+	})
+
+	It("drops non-finite DOUBLE values when enabled", func() {
+		descriptor := *testDescriptor
+		descriptor.ValueType = "DOUBLE"
+		nan, inf := math.NaN(), math.Inf(1)
+		nanSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		nanSeries.ValueType = "DOUBLE"
+		nanSeries.Points[0].Value = &monitoring.TypedValue{DoubleValue: &nan}
+		infSeries := int64TimeSeries(nil, map[string]string{"instance_id": "2"}, 0)
+		infSeries.ValueType = "DOUBLE"
+		infSeries.Points[0].Value = &monitoring.TypedValue{DoubleValue: &inf}
+
+		c.collectorNonFiniteValues = "drop"
+		Expect(reportTimeSeries(c, &descriptor, nanSeries, infSeries)).To(BeEmpty())
+	})
+
+	It("passes negative counter values through by default and counts them", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, -2)
+		timeSeries.MetricKind = "DELTA"
+
+		c.deltaCounters = newDeltaCounterStore(time.Hour, 0)
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetCounter().GetValue()).To(Equal(float64(-2)))
+
+		m := &dto.Metric{}
+		Expect(c.negativeCounterValuesTotalMetric.WithLabelValues(testDescriptor.Type).Write(m)).To(Succeed())
+		Expect(m.GetCounter().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("clamps negative counter values to zero when enabled", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, -2)
+		timeSeries.MetricKind = "DELTA"
+
+		c.deltaCounters = newDeltaCounterStore(time.Hour, 0)
+		c.collectorNegativeCounterValues = "clamp"
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetCounter().GetValue()).To(Equal(float64(0)))
+	})
+
+	It("drops negative counter values when enabled, but not negative gauges", func() {
+		counterSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, -2)
+		counterSeries.MetricKind = "DELTA"
+		gaugeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "2"}, -2)
+
+		c.deltaCounters = newDeltaCounterStore(time.Hour, 0)
+		c.collectorNegativeCounterValues = "drop"
+		Expect(reportTimeSeries(c, testDescriptor, counterSeries)).To(BeEmpty())
+		metrics := reportTimeSeries(c, testDescriptor, gaugeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(-2)))
+
+		m := &dto.Metric{}
+		Expect(c.negativeCounterValuesTotalMetric.WithLabelValues(testDescriptor.Type).Write(m)).To(Succeed())
+		Expect(m.GetCounter().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("falls back to the kind and value type of the descriptor", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 3)
+		timeSeries.MetricKind = ""
+		timeSeries.ValueType = ""
+
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(3)))
+	})
+
+	It("reports the presence of time series in the HEADERS view", func() {
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.Points = nil
+
+		c.timeSeriesView = "HEADERS"
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].GetGauge().GetValue()).To(Equal(float64(1)))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("instance_id", "1"))
+	})
+
+	It("drops the labels with an empty value when enabled", func() {
+		timeSeries := int64TimeSeries(map[string]string{"state": ""}, map[string]string{"instance_id": "1", "zone": ""}, 1)
+
+		c.collectorDropEmptyLabels = true
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).ToNot(HaveKey("state"))
+		Expect(metricLabels(metrics[0])).ToNot(HaveKey("zone"))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("instance_id", "1"))
+	})
+
+	It("keeps the empty labels set on other series of the same metric", func() {
+		emptyZone := int64TimeSeries(nil, map[string]string{"instance_id": "1", "zone": ""}, 1)
+		zone := int64TimeSeries(nil, map[string]string{"instance_id": "2", "zone": "us-central1-a"}, 1)
+
+		c.collectorDropEmptyLabels = true
+		metrics := reportTimeSeries(c, testDescriptor, emptyZone, zone)
+		Expect(metrics).To(HaveLen(2))
+		for _, metric := range metrics {
+			Expect(metricLabels(metric)).To(HaveKey("zone"))
+		}
+	})
+
+	It("adds the extra const labels and renames the colliding labels", func() {
+		timeSeries := int64TimeSeries(map[string]string{"env": "dev"}, map[string]string{"instance_id": "1"}, 1)
+
+		c.extraLabels = prometheus.Labels{"env": "prod"}
+		metrics := reportTimeSeries(c, testDescriptor, timeSeries)
+		Expect(metrics).To(HaveLen(1))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("env", "prod"))
+		Expect(metricLabels(metrics[0])).To(HaveKeyWithValue("exported_env", "dev"))
+	})
+})
+
+var _ = Describe("NewMonitoringCollector", func() {
+	It("rejects extra const labels colliding with the collector metrics labels", func() {
+		_, err := NewMonitoringCollector("test-project", nil, newTestOptions(), prometheus.Labels{"reason": "x"}, log.NewNopLogger())
+		Expect(err).To(MatchError(ContainSubstring(`Const label "reason" collides`)))
+	})
+
+	It("rejects invalid extra const label names", func() {
+		_, err := NewMonitoringCollector("test-project", nil, newTestOptions(), prometheus.Labels{"1env": "x"}, log.NewNopLogger())
+		Expect(err).To(MatchError(ContainSubstring("not a valid label name")))
+	})
+})
+
+var _ = Describe("reportDescriptorMetadata", func() {
+	It("reports the ingest delay and sample period of the descriptor", func() {
+		c := &MonitoringCollector{
+			metricIngestDelayDesc:  prometheus.NewDesc("ingest_delay", "", []string{"metric_type"}, nil),
+			metricSamplePeriodDesc: prometheus.NewDesc("sample_period", "", []string{"metric_type"}, nil),
+		}
+		descriptor := *testDescriptor
+		descriptor.Metadata = &monitoring.MetricDescriptorMetadata{IngestDelay: "240s", SamplePeriod: "60s"}
+
+		ch := make(chan prometheus.Metric, 2)
+		c.reportDescriptorMetadata(&descriptor, ch)
+		close(ch)
+
+		var values []float64
+		for metric := range ch {
+			m := &dto.Metric{}
+			Expect(metric.Write(m)).To(Succeed())
+			Expect(metricLabels(m)).To(Equal(map[string]string{"metric_type": descriptor.Type}))
+			values = append(values, m.GetGauge().GetValue())
+		}
+		Expect(values).To(Equal([]float64{240, 60}))
+	})
+
+	It("reports nothing without metadata", func() {
+		ch := make(chan prometheus.Metric, 2)
+		(&MonitoringCollector{}).reportDescriptorMetadata(testDescriptor, ch)
+		Expect(ch).To(BeEmpty())
+	})
+})
+
+// jsonResponse returns a Monitoring API response with the given JSON body.
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// newTestService returns a Monitoring API client listing a single Metric
+// Descriptor, and answering the Time Series listings with timeSeries.
+func newTestService(timeSeries roundTripperFunc) *monitoring.Service {
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasSuffix(req.URL.Path, "/timeSeries") {
+			return timeSeries(req)
+		}
+		return jsonResponse(`{"metricDescriptors": [{"type": "compute.googleapis.com/instance/cpu/utilization", "metricKind": "GAUGE", "valueType": "INT64"}]}`), nil
+	})}
+	service, err := monitoring.NewService(context.Background(), option.WithHTTPClient(client), option.WithEndpoint("https://monitoring.example.com/"))
+	Expect(err).ToNot(HaveOccurred())
+	return service
+}
+
+var _ = Describe("Collect", func() {
+	var c *MonitoringCollector
+
+	BeforeEach(func() {
+		c = newTestCollector()
+	})
+
+	It("recovers from panics while reporting a metric descriptor", func() {
+		c.monitoringService = newTestService(func(*http.Request) (*http.Response, error) {
+			panic("malformed Time Series")
+		})
+
+		ch := make(chan prometheus.Metric, 100)
+		c.Collect(ch)
+		close(ch)
+
+		lastScrapeError := &dto.Metric{}
+		Expect(c.lastScrapeErrorMetric.Write(lastScrapeError)).To(Succeed())
+		Expect(lastScrapeError.GetGauge().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("reports the scrape duration of each Metric Type prefix", func() {
+		c.monitoringService = newTestService(func(*http.Request) (*http.Response, error) {
+			return jsonResponse(`{}`), nil
+		})
+
+		ch := make(chan prometheus.Metric, 100)
+		c.Collect(ch)
+		close(ch)
+
+		var prefixes []string
+		for metric := range ch {
+			if !strings.Contains(metric.Desc().String(), `"stackdriver_monitoring_prefix_scrape_duration_seconds"`) {
+				continue
+			}
+			m := &dto.Metric{}
+			Expect(metric.Write(m)).To(Succeed())
+			Expect(m.GetGauge().GetValue()).To(BeNumerically(">", 0))
+			prefixes = append(prefixes, metricLabels(m)["metric_type_prefix"])
+		}
+		Expect(prefixes).To(Equal([]string{"compute.googleapis.com/"}))
+	})
+
+	It("reports whether Stackdriver Monitoring could be reached", func() {
+		c.monitoringService = newTestService(func(*http.Request) (*http.Response, error) {
+			return jsonResponse(`{}`), nil
+		})
+		c.Collect(make(chan prometheus.Metric, 100))
+
+		up := &dto.Metric{}
+		Expect(c.upMetric.Write(up)).To(Succeed())
+		Expect(up.GetGauge().GetValue()).To(Equal(float64(1)))
+
+		client := &http.Client{Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusForbidden, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})}
+		service, err := monitoring.NewService(context.Background(), option.WithHTTPClient(client))
+		Expect(err).ToNot(HaveOccurred())
+		c = newTestCollector()
+		c.monitoringService = service
+		c.Collect(make(chan prometheus.Metric, 100))
+
+		Expect(c.upMetric.Write(up)).To(Succeed())
+		Expect(up.GetGauge().GetValue()).To(Equal(float64(0)))
+	})
+
+	It("requests pages of the configured size", func() {
+		c.pageSize = 500
+
+		var timeSeriesPageSize string
+		c.monitoringService = newTestService(func(req *http.Request) (*http.Response, error) {
+			timeSeriesPageSize = req.URL.Query().Get("pageSize")
+			return jsonResponse(`{}`), nil
+		})
+		c.Collect(make(chan prometheus.Metric, 100))
+		Expect(timeSeriesPageSize).To(Equal("500"))
+
+		var descriptorsPageSize string
+		client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			descriptorsPageSize = req.URL.Query().Get("pageSize")
+			return jsonResponse(`{}`), nil
+		})}
+		service, err := monitoring.NewService(context.Background(), option.WithHTTPClient(client))
+		Expect(err).ToNot(HaveOccurred())
+		c.monitoringService = service
+		_, err = c.ListMetricDescriptors("compute.googleapis.com/")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(descriptorsPageSize).To(Equal("500"))
+	})
+
+	It("counts the Time Series listings failing after some pages were reported", func() {
+		c.monitoringService = newTestService(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Query().Get("pageToken") == "" {
+				return jsonResponse(`{"nextPageToken": "next"}`), nil
+			}
+			return &http.Response{StatusCode: http.StatusForbidden, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})
+		c.Collect(make(chan prometheus.Metric, 100))
+
+		partialScrapes := &dto.Metric{}
+		Expect(c.partialScrapesTotalMetric.Write(partialScrapes)).To(Succeed())
+		Expect(partialScrapes.GetCounter().GetValue()).To(Equal(float64(1)))
+
+		c.monitoringService = newTestService(func(*http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusForbidden, Body: ioutil.NopCloser(strings.NewReader(""))}, nil
+		})
+		c.Collect(make(chan prometheus.Metric, 100))
+
+		Expect(c.partialScrapesTotalMetric.Write(partialScrapes)).To(Succeed())
+		Expect(partialScrapes.GetCounter().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("aborts the API calls in flight once the context is done", func() {
+		c.monitoringService = newTestService(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		begun := time.Now()
+		c.CollectWithContext(ctx, make(chan prometheus.Metric, 100))
+		Expect(time.Since(begun)).To(BeNumerically("<", time.Second))
+
+		lastScrapeError := &dto.Metric{}
+		Expect(c.lastScrapeErrorMetric.Write(lastScrapeError)).To(Succeed())
+		Expect(lastScrapeError.GetGauge().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("reports the interval of the Time Series request of each metric type", func() {
+		var startTime, endTime time.Time
+		c.monitoringService = newTestService(func(req *http.Request) (*http.Response, error) {
+			var err error
+			startTime, err = time.Parse(time.RFC3339Nano, req.URL.Query().Get("interval.startTime"))
+			Expect(err).ToNot(HaveOccurred())
+			endTime, err = time.Parse(time.RFC3339Nano, req.URL.Query().Get("interval.endTime"))
+			Expect(err).ToNot(HaveOccurred())
+			return jsonResponse(`{}`), nil
+		})
+		c.Collect(make(chan prometheus.Metric, 100))
+
+		m := &dto.Metric{}
+		Expect(c.queryWindowStartSecondsMetric.WithLabelValues("compute.googleapis.com/instance/cpu/utilization").Write(m)).To(Succeed())
+		Expect(m.GetGauge().GetValue()).To(Equal(float64(startTime.Unix())))
+		Expect(c.queryWindowEndSecondsMetric.WithLabelValues("compute.googleapis.com/instance/cpu/utilization").Write(m)).To(Succeed())
+		Expect(m.GetGauge().GetValue()).To(Equal(float64(endTime.Unix())))
+		Expect(endTime).To(BeTemporally(">", startTime))
+	})
+
+	It("observes the duration of the API calls by method", func() {
+		c.monitoringService = newTestService(func(*http.Request) (*http.Response, error) {
+			return jsonResponse(`{}`), nil
+		})
+		c.Collect(make(chan prometheus.Metric, 100))
+
+		for _, method := range []string{"metricDescriptors.list", "timeSeries.list"} {
+			m := &dto.Metric{}
+			Expect(c.apiCallDurationSecondsMetric.WithLabelValues(method).(prometheus.Histogram).Write(m)).To(Succeed())
+			Expect(m.GetHistogram().GetSampleCount()).To(Equal(uint64(1)), method)
+		}
+	})
+
+	It("stops waiting for the prefix jitter once the context is done", func() {
+		c.prefixJitter = time.Hour
+		c.monitoringService = newTestService(func(*http.Request) (*http.Response, error) {
+			return jsonResponse(`{}`), nil
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		begun := time.Now()
+		c.CollectWithContext(ctx, make(chan prometheus.Metric, 100))
+		Expect(time.Since(begun)).To(BeNumerically("<", time.Second))
+
+		lastScrapeError := &dto.Metric{}
+		Expect(c.lastScrapeErrorMetric.Write(lastScrapeError)).To(Succeed())
+		Expect(lastScrapeError.GetGauge().GetValue()).To(Equal(float64(1)))
+	})
+
+	It("marks the scrape as failed once the scrape timeout is reached", func() {
+		c.scrapeTimeout = 50 * time.Millisecond
+		c.monitoringService = newTestService(func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})
+
+		begun := time.Now()
+		c.Collect(make(chan prometheus.Metric, 100))
+		Expect(time.Since(begun)).To(BeNumerically("<", time.Second))
+
+		lastScrapeError := &dto.Metric{}
+		Expect(c.lastScrapeErrorMetric.Write(lastScrapeError)).To(Succeed())
+		Expect(lastScrapeError.GetGauge().GetValue()).To(Equal(float64(1)))
+	})
+})
+
+var _ = Describe("NewMonitoringCollector", func() {
+	It("names its own metrics after the configured namespace and subsystem", func() {
+		options := newTestOptions()
+		options.Namespace = "gcp"
+		options.Subsystem = "exporter"
+		c, err := NewMonitoringCollector("test-project", nil, options, nil, log.NewNopLogger())
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(c.apiCallsTotalMetric.Desc().String()).To(ContainSubstring(`fqName: "gcp_exporter_api_calls_total"`))
+		Expect(c.namespace).To(Equal("gcp"))
+	})
+
+	It("tags its logs with the project", func() {
+		var logs bytes.Buffer
+		c, err := NewMonitoringCollector("test-project", nil, newTestOptions(), nil, log.NewLogfmtLogger(&logs))
+		Expect(err).ToNot(HaveOccurred())
+
+		c.logger.Log("msg", "scraping")
+		Expect(logs.String()).To(Equal("project_id=test-project msg=scraping\n"))
+	})
+})
+
+var _ = Describe("finiteValue", func() {
+	It("passes non-finite values through by default", func() {
+		c := &MonitoringCollector{collectorNonFiniteValues: "pass"}
+		value, ok := c.finiteValue(math.Inf(1))
+		Expect(ok).To(BeTrue())
+		Expect(math.IsInf(value, 1)).To(BeTrue())
+		value, ok = c.finiteValue(math.NaN())
+		Expect(ok).To(BeTrue())
+		Expect(math.IsNaN(value)).To(BeTrue())
+	})
+
+	It("drops non-finite values when enabled", func() {
+		c := &MonitoringCollector{collectorNonFiniteValues: "drop"}
+		_, ok := c.finiteValue(math.Inf(-1))
+		Expect(ok).To(BeFalse())
+		_, ok = c.finiteValue(math.NaN())
+		Expect(ok).To(BeFalse())
+		value, ok := c.finiteValue(1.5)
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(1.5))
+	})
+
+	It("clamps infinities and drops NaN when enabled", func() {
+		c := &MonitoringCollector{collectorNonFiniteValues: "clamp"}
+		value, ok := c.finiteValue(math.Inf(1))
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(math.MaxFloat64))
+		value, ok = c.finiteValue(math.Inf(-1))
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(-math.MaxFloat64))
+		_, ok = c.finiteValue(math.NaN())
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("reportMetricInfo", func() {
+	It("reports the properties of the descriptor as labels", func() {
+		c := newTestCollector()
+		descriptor := *testDescriptor
+		descriptor.LaunchStage = "GA"
+		ch := make(chan prometheus.Metric, 1)
+		c.reportMetricInfo(&descriptor, ch)
+
+		m := &dto.Metric{}
+		Expect((<-ch).Write(m)).To(Succeed())
+		Expect(m.GetGauge().GetValue()).To(Equal(float64(1)))
+		Expect(metricLabels(m)).To(Equal(map[string]string{
+			"project_id":   "test-project",
+			"metric_type":  "compute.googleapis.com/instance/cpu/utilization",
+			"unit":         "1",
+			"value_type":   "INT64",
+			"metric_kind":  "GAUGE",
+			"launch_stage": "GA",
+		}))
+	})
+})
+
+var _ = Describe("reportConfig", func() {
+	It("reports the interval, offset and request timeout", func() {
+		c := newTestCollector()
+		c.metricsInterval = 5 * time.Minute
+		c.metricsIntervalOverrides = map[string]time.Duration{"pubsub.googleapis.com/": time.Minute}
+		c.metricsOffset = 2 * time.Minute
+		c.requestTimeout = 30 * time.Second
+		ch := make(chan prometheus.Metric, 4)
+		c.reportConfig(ch)
+		close(ch)
+
+		values := make(map[string]float64)
+		for metric := range ch {
+			m := &dto.Metric{}
+			Expect(metric.Write(m)).To(Succeed())
+			name := regexp.MustCompile(`fqName: "([a-z_]+)"`).FindStringSubmatch(metric.Desc().String())[1]
+			values[name] = m.GetGauge().GetValue()
+		}
+		Expect(values).To(Equal(map[string]float64{
+			"stackdriver_monitoring_config_interval_seconds":          300,
+			"stackdriver_monitoring_config_interval_override_seconds": 60,
+			"stackdriver_monitoring_config_offset_seconds":            120,
+			"stackdriver_monitoring_config_request_timeout_seconds":   30,
+		}))
+	})
+})
+
+var _ = Describe("reportPointAges", func() {
+	It("reports the age of the newest point of each metric type", func() {
+		c := newTestCollector()
+		endTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		c.observeNewestPoint("a", endTime)
+		c.observeNewestPoint("a", endTime.Add(-time.Minute))
+		c.observeNewestPoint("b", time.Unix(0, 0))
+		c.reportPointAges(endTime.Add(time.Minute))
+
+		Expect(c.newestPoints).To(HaveLen(1))
+		m := &dto.Metric{}
+		Expect(c.pointAgeSecondsMetric.WithLabelValues("a").Write(m)).To(Succeed())
+		Expect(m.GetGauge().GetValue()).To(Equal(float64(60)))
+	})
+})
+
+var _ = Describe("jitterDelay", func() {
+	It("returns a random delay up to the max", func() {
+		for i := 0; i < 100; i++ {
+			Expect(jitterDelay(time.Second)).To(And(BeNumerically(">=", 0), BeNumerically("<", time.Second)))
+		}
+	})
+
+	It("returns no delay without a max", func() {
+		Expect(jitterDelay(0)).To(BeZero())
+	})
+})
+
+var _ = Describe("CollectOnce", func() {
+	It("returns a registry gathering the metrics of a single scrape", func() {
+		c := newTestCollector()
+		c.metricsTypePrefixes = nil
+
+		registry, err := c.CollectOnce(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		var scrapes float64
+		for _, family := range families {
+			if family.GetName() == "stackdriver_monitoring_scrapes_total" {
+				scrapes = family.GetMetric()[0].GetCounter().GetValue()
+			}
+		}
+		Expect(scrapes).To(Equal(float64(1)))
+	})
+
+	It("collects more prefixes than the concurrent prefixes limit", func() {
+		c := newTestCollector()
+		c.metricsTypePrefixes = []string{"compute.googleapis.com/", "pubsub.googleapis.com/", "storage.googleapis.com/"}
+		c.descriptorCache = newDescriptorCache(0)
+		for _, prefix := range c.metricsTypePrefixes {
+			c.descriptorCache.Store(prefix, nil)
+		}
+		c.workers = newWorkerPool(1, nil)
+		c.prefixWorkers = newWorkerPool(1, nil)
+
+		_, err := c.CollectOnce(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("reports the number of descriptors listed per prefix as a gauge", func() {
+		c := newTestCollector()
+		c.descriptorCache = newDescriptorCache(0)
+		c.descriptorCache.Store("compute.googleapis.com/", []*monitoring.MetricDescriptor{{Type: "compute.googleapis.com/instance/cpu/usage_time"}, {Type: "compute.googleapis.com/instance/cpu/utilization"}})
+		// Only the descriptors are served, their Time Series are not listed
+		c.metricKinds = map[string]bool{"CUMULATIVE": true}
+
+		registry, err := c.CollectOnce(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+
+		families, err := registry.Gather()
+		Expect(err).ToNot(HaveOccurred())
+		var found bool
+		for _, family := range families {
+			if family.GetName() == "stackdriver_monitoring_metric_descriptors" {
+				found = true
+				Expect(family.GetType()).To(Equal(dto.MetricType_GAUGE))
+				Expect(family.GetMetric()[0].GetGauge().GetValue()).To(Equal(float64(2)))
+			}
+		}
+		Expect(found).To(BeTrue())
+	})
+})
+
+var _ = Describe("reportPermissionError", func() {
+	It("counts the permission errors of each prefix", func() {
+		c := newTestCollector()
+		err := &googleapi.Error{Code: http.StatusForbidden}
+		Expect(isPermissionDeniedError(err)).To(BeTrue())
+		Expect(isPermissionDeniedError(&googleapi.Error{Code: http.StatusNotFound})).To(BeFalse())
+
+		c.reportPermissionError("compute.googleapis.com/", err)
+		c.reportPermissionError("compute.googleapis.com/", err)
+		Expect(c.permissionErrorsLogged).To(HaveKey("compute.googleapis.com/"))
+
+		m := &dto.Metric{}
+		Expect(c.prefixPermissionErrorsTotalMetric.WithLabelValues("compute.googleapis.com/").Write(m)).To(Succeed())
+		Expect(m.GetCounter().GetValue()).To(Equal(float64(2)))
+	})
+})
+
+var _ = Describe("scrapeErrorReasons", func() {
+	It("classifies the errors by status code and type", func() {
+		Expect(errorReason(&googleapi.Error{Code: http.StatusUnauthorized})).To(Equal("auth"))
+		Expect(errorReason(fmt.Errorf("listing: %w", &googleapi.Error{Code: http.StatusTooManyRequests}))).To(Equal("quota"))
+		Expect(errorReason(context.DeadlineExceeded)).To(Equal("timeout"))
+		Expect(errorReason(&PointParseError{Err: errors.New("bad time")})).To(Equal("parse"))
+		Expect(errorReason(&googleapi.Error{Code: http.StatusInternalServerError})).To(Equal("other"))
+	})
+
+	It("returns the distinct reasons of several errors", func() {
+		err := scrapeErrors{
+			&googleapi.Error{Code: http.StatusForbidden},
+			&googleapi.Error{Code: http.StatusUnauthorized},
+			errors.New("unknown"),
+		}
+		Expect(scrapeErrorReasons(err)).To(Equal([]string{"auth", "other"}))
+	})
+})
+
+var _ = Describe("drainErrors", func() {
+	var errChannel chan error
+
+	BeforeEach(func() {
+		errChannel = make(chan error, 3)
+		errChannel <- errors.New("first")
+		errChannel <- scrapeErrors{errors.New("second"), errors.New("third")}
+		close(errChannel)
+	})
+
+	It("returns the first error", func() {
+		c := &MonitoringCollector{}
+		Expect(c.drainErrors(errChannel)).To(MatchError("first"))
+	})
+
+	It("returns all the errors in best effort mode", func() {
+		c := &MonitoringCollector{collectorBestEffort: true}
+		err := c.drainErrors(errChannel)
+		Expect(err).To(MatchError("first; second; third"))
+		Expect(err).To(HaveLen(3))
+	})
+
+	It("returns no error in best effort mode when there are none", func() {
+		c := &MonitoringCollector{collectorBestEffort: true}
+		empty := make(chan error)
+		close(empty)
+		Expect(c.drainErrors(empty)).To(Succeed())
+	})
+})
@@ -14,6 +14,8 @@
 package collectors
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -24,32 +26,112 @@ import (
 	"github.com/prometheus-community/stackdriver_exporter/utils"
 )
 
-func buildFQName(timeSeries *monitoring.TimeSeries) string {
+func (t *TimeSeriesMetrics) buildFQName(timeSeries *monitoring.TimeSeries, unitSuffix string) string {
 	// The metric name to report is composed by the 3 parts:
-	// 1. namespace is a constant prefix (stackdriver)
+	// 1. namespace is a configurable prefix (stackdriver by default)
 	// 2. subsystem is the monitored resource type (ie gce_instance)
-	// 3. name is the metric type (ie compute.googleapis.com/instance/cpu/usage_time)
-	return prometheus.BuildFQName("stackdriver", utils.NormalizeMetricName(timeSeries.Resource.Type), utils.NormalizeMetricName(timeSeries.Metric.Type))
+	// 3. name is the metric type (ie compute.googleapis.com/instance/cpu/usage_time),
+	//    optionally followed by the unit suffix (ie seconds)
+	// A namespace override of the metric type prefix replaces the namespace,
+	// and the subsystem if set, and the prefix is trimmed from the name.
+	namespace, subsystem, metricType := t.namespace, utils.NormalizeMetricName(timeSeries.Resource.Type), timeSeries.Metric.Type
+	if o := t.namespaceOverride; o != nil {
+		namespace = o.namespace
+		if o.hasSubsystem {
+			subsystem = o.subsystem
+		}
+		if trimmed := strings.TrimPrefix(metricType, o.prefix); trimmed != "" {
+			metricType = trimmed
+		}
+	}
+	name := utils.NormalizeMetricName(metricType)
+	if unitSuffix != "" && !strings.HasSuffix(name, "_"+unitSuffix) {
+		name = name + "_" + unitSuffix
+	}
+	return prometheus.BuildFQName(namespace, subsystem, name)
 }
 
 type TimeSeriesMetrics struct {
-	metricDescriptor *monitoring.MetricDescriptor
-	ch               chan<- prometheus.Metric
+	namespace         string
+	namespaceOverride *namespaceOverride
+	metricDescriptor  *monitoring.MetricDescriptor
+	ch                chan<- prometheus.Metric
+
+	fillMissingLabels  bool
+	unitSuffix         string
+	unitInHelp         bool
+	helpMaxLength      int
+	helpStripNewlines  bool
+	counterTotalSuffix bool
+	withTimestamp      bool
+	rate               bool
+	accumulateDeltas   bool
+	constLabels        prometheus.Labels
+	constMetrics       map[string][]ConstMetric
+	histogramMetrics   map[string][]HistogramMetric
 
-	fillMissingLabels bool
-	constMetrics      map[string][]ConstMetric
-	histogramMetrics  map[string][]HistogramMetric
+	// recorder keeps the reported metrics to push them over OTLP, if set
+	recorder *otlpRecorder
+}
+
+// metricHelp returns the help of a metric from the description of its Metric
+// Descriptor, or a default one when it has none.
+func (t *TimeSeriesMetrics) metricHelp() string {
+	help := t.metricDescriptor.Description
+	if help == "" {
+		return fmt.Sprintf("Google Stackdriver Monitoring metric %s.", t.metricDescriptor.Type)
+	}
+	if t.helpStripNewlines {
+		help = strings.Join(strings.Fields(help), " ")
+	}
+	if runes := []rune(help); t.helpMaxLength > 0 && len(runes) > t.helpMaxLength {
+		help = strings.TrimSpace(string(runes[:t.helpMaxLength]))
+	}
+	return help
 }
 
 func (t *TimeSeriesMetrics) newMetricDesc(fqName string, labelKeys []string) *prometheus.Desc {
+	help := t.metricHelp()
+	if t.unitInHelp && t.metricDescriptor.Unit != "" {
+		help = fmt.Sprintf("%s (unit: %s)", help, t.metricDescriptor.Unit)
+	}
 	return prometheus.NewDesc(
 		fqName,
-		t.metricDescriptor.Description,
-		labelKeys,
-		prometheus.Labels{},
+		help,
+		exportedLabelKeys(labelKeys, t.constLabels),
+		t.constLabels,
 	)
 }
 
+// exportedLabelKeys renames the label keys colliding with a const label by
+// prefixing them with `exported_`, as Prometheus does for target labels.
+func exportedLabelKeys(labelKeys []string, constLabels prometheus.Labels) []string {
+	if len(constLabels) == 0 {
+		return labelKeys
+	}
+	var result []string
+	for i, key := range labelKeys {
+		if _, ok := constLabels[key]; !ok {
+			continue
+		}
+		if result == nil {
+			result = make([]string, len(labelKeys))
+			copy(result, labelKeys)
+		}
+		for {
+			key = "exported_" + key
+			if _, ok := constLabels[key]; !ok && !hasLabelKey(result, key) {
+				break
+			}
+		}
+		result[i] = key
+	}
+	if result == nil {
+		return labelKeys
+	}
+	return result
+}
+
 type ConstMetric struct {
 	fqName      string
 	labelKeys   []string
@@ -57,6 +139,8 @@ type ConstMetric struct {
 	value       float64
 	labelValues []string
 	reportTime  time.Time
+	startTime   time.Time
+	accumulated bool
 
 	keysHash uint64
 }
@@ -64,45 +148,56 @@ type ConstMetric struct {
 type HistogramMetric struct {
 	fqName      string
 	labelKeys   []string
-	dist        *monitoring.Distribution
+	count       uint64
+	sum         float64
 	buckets     map[float64]uint64
 	labelValues []string
 	reportTime  time.Time
+	startTime   time.Time
+	accumulated bool
 
 	keysHash uint64
 }
 
-func (t *TimeSeriesMetrics) CollectNewConstHistogram(timeSeries *monitoring.TimeSeries, reportTime time.Time, labelKeys []string, dist *monitoring.Distribution, buckets map[float64]uint64, labelValues []string) {
-	fqName := buildFQName(timeSeries)
+func (t *TimeSeriesMetrics) CollectNewConstHistogram(timeSeries *monitoring.TimeSeries, reportTime time.Time, labelKeys []string, count uint64, sum float64, buckets map[float64]uint64, labelValues []string) {
+	fqName := t.buildFQName(timeSeries, t.unitSuffix)
+	v := HistogramMetric{
+		fqName:      fqName,
+		labelKeys:   labelKeys,
+		count:       count,
+		sum:         sum,
+		buckets:     buckets,
+		labelValues: labelValues,
+		reportTime:  reportTime,
+		startTime:   t.startTime(timeSeries),
+		accumulated: t.deltasAccumulated(timeSeries),
+
+		keysHash: hashLabelKeys(labelKeys),
+	}
 
 	if t.fillMissingLabels {
-		vs, ok := t.histogramMetrics[fqName]
-		if !ok {
-			vs = make([]HistogramMetric, 0)
-		}
-		v := HistogramMetric{
-			fqName:      fqName,
-			labelKeys:   labelKeys,
-			dist:        dist,
-			buckets:     buckets,
-			labelValues: labelValues,
-			reportTime:  reportTime,
-
-			keysHash: hashLabelKeys(labelKeys),
-		}
-		t.histogramMetrics[fqName] = append(vs, v)
+		t.histogramMetrics[fqName] = append(t.histogramMetrics[fqName], v)
 		return
 	}
-	t.ch <- t.newConstHistogram(fqName, reportTime, labelKeys, dist, buckets, labelValues)
+	t.reportHistogramMetric(v)
+}
+
+// reportHistogramMetric sends a histogram to the channel, and to the OTLP
+// recorder if any.
+func (t *TimeSeriesMetrics) reportHistogramMetric(v HistogramMetric) {
+	t.ch <- t.newConstHistogram(v.fqName, v.reportTime, v.labelKeys, v.count, v.sum, v.buckets, v.labelValues)
+	if t.recorder != nil {
+		t.recorder.recordHistogram(t.metricHelp(), t.constLabels, v)
+	}
 }
 
-func (t *TimeSeriesMetrics) newConstHistogram(fqName string, reportTime time.Time, labelKeys []string, dist *monitoring.Distribution, buckets map[float64]uint64, labelValues []string) prometheus.Metric {
-	return prometheus.NewMetricWithTimestamp(
+func (t *TimeSeriesMetrics) newConstHistogram(fqName string, reportTime time.Time, labelKeys []string, count uint64, sum float64, buckets map[float64]uint64, labelValues []string) prometheus.Metric {
+	return t.withReportTime(
 		reportTime,
 		prometheus.MustNewConstHistogram(
 			t.newMetricDesc(fqName, labelKeys),
-			uint64(dist.Count),
-			dist.Mean*float64(dist.Count), // Stackdriver does not provide the sum, but we can fake it
+			count,
+			sum,
 			buckets,
 			labelValues...,
 		),
@@ -110,31 +205,113 @@ func (t *TimeSeriesMetrics) newConstHistogram(fqName string, reportTime time.Tim
 }
 
 func (t *TimeSeriesMetrics) CollectNewConstMetric(timeSeries *monitoring.TimeSeries, reportTime time.Time, labelKeys []string, metricValueType prometheus.ValueType, metricValue float64, labelValues []string) {
-	fqName := buildFQName(timeSeries)
+	fqName := t.buildFQName(timeSeries, t.unitSuffix)
+	if t.rate {
+		fqName = fqName + "_rate"
+	}
+	if t.counterTotalSuffix && metricValueType == prometheus.CounterValue && !strings.HasSuffix(fqName, "_total") {
+		fqName = fqName + "_total"
+	}
+	t.collectConstMetric(timeSeries, fqName, reportTime, labelKeys, metricValueType, metricValue, labelValues)
+}
+
+// CollectNewConstDistributionMeanCount reports the mean and count of a
+// distribution as `_mean` and `_count` metrics, without its buckets.
+func (t *TimeSeriesMetrics) CollectNewConstDistributionMeanCount(timeSeries *monitoring.TimeSeries, reportTime time.Time, labelKeys []string, countValueType prometheus.ValueType, mean float64, count uint64, labelValues []string) {
+	t.collectConstMetric(timeSeries, t.buildFQName(timeSeries, t.unitSuffix)+"_mean", reportTime, labelKeys, prometheus.GaugeValue, mean, labelValues)
+	t.collectConstMetric(timeSeries, t.buildFQName(timeSeries, "")+"_count", reportTime, labelKeys, countValueType, float64(count), labelValues)
+}
+
+// CollectNewConstInfoMetric reports a `_info` gauge with a constant value of 1
+// for metrics whose value is carried by their labels.
+func (t *TimeSeriesMetrics) CollectNewConstInfoMetric(timeSeries *monitoring.TimeSeries, reportTime time.Time, labelKeys []string, labelValues []string) {
+	t.collectConstMetric(timeSeries, t.buildFQName(timeSeries, "")+"_info", reportTime, labelKeys, prometheus.GaugeValue, 1, labelValues)
+}
+
+// CollectNewConstPresenceMetric reports a `_present` gauge with a constant
+// value of 1 for Time Series retrieved without their points.
+func (t *TimeSeriesMetrics) CollectNewConstPresenceMetric(timeSeries *monitoring.TimeSeries, reportTime time.Time, labelKeys []string, labelValues []string) {
+	t.collectConstMetric(timeSeries, t.buildFQName(timeSeries, "")+"_present", reportTime, labelKeys, prometheus.GaugeValue, 1, labelValues)
+}
+
+func (t *TimeSeriesMetrics) collectConstMetric(timeSeries *monitoring.TimeSeries, fqName string, reportTime time.Time, labelKeys []string, metricValueType prometheus.ValueType, metricValue float64, labelValues []string) {
+	v := ConstMetric{
+		fqName:      fqName,
+		labelKeys:   labelKeys,
+		valueType:   metricValueType,
+		value:       metricValue,
+		labelValues: labelValues,
+		reportTime:  reportTime,
+		startTime:   t.startTime(timeSeries),
+		accumulated: t.deltasAccumulated(timeSeries),
+
+		keysHash: hashLabelKeys(labelKeys),
+	}
 
 	if t.fillMissingLabels {
-		vs, ok := t.constMetrics[fqName]
-		if !ok {
-			vs = make([]ConstMetric, 0)
+		t.constMetrics[fqName] = append(t.constMetrics[fqName], v)
+		return
+	}
+	t.reportConstMetric(v)
+}
+
+// reportConstMetric sends a metric to the channel, and to the OTLP recorder
+// if any.
+func (t *TimeSeriesMetrics) reportConstMetric(v ConstMetric) {
+	t.ch <- t.newConstMetric(v.fqName, v.reportTime, v.labelKeys, v.valueType, v.value, v.labelValues)
+	if t.recorder != nil {
+		t.recorder.recordConstMetric(t.metricHelp(), t.constLabels, v)
+	}
+}
+
+// startTime returns the start of the newest point of a Time Series, or of
+// its oldest point when its DELTA points are accumulated into a running
+// total. It is zero for the points without a start time, ie GAUGE points,
+// and when there is no OTLP recorder to use it.
+func (t *TimeSeriesMetrics) startTime(timeSeries *monitoring.TimeSeries) time.Time {
+	if t.recorder == nil {
+		return time.Time{}
+	}
+	oldest := t.deltasAccumulated(timeSeries)
+
+	var startTime, newestEndTime time.Time
+	for _, point := range timeSeries.Points {
+		if point.Interval == nil || point.Interval.StartTime == "" {
+			continue
 		}
-		v := ConstMetric{
-			fqName:      fqName,
-			labelKeys:   labelKeys,
-			valueType:   metricValueType,
-			value:       metricValue,
-			labelValues: labelValues,
-			reportTime:  reportTime,
-
-			keysHash: hashLabelKeys(labelKeys),
+		pointStartTime, err := time.Parse(time.RFC3339Nano, point.Interval.StartTime)
+		if err != nil {
+			continue
+		}
+		if oldest {
+			if startTime.IsZero() || pointStartTime.Before(startTime) {
+				startTime = pointStartTime
+			}
+			continue
+		}
+		endTime, err := time.Parse(time.RFC3339Nano, point.Interval.EndTime)
+		if err != nil {
+			continue
+		}
+		if endTime.After(newestEndTime) {
+			startTime, newestEndTime = pointStartTime, endTime
 		}
-		t.constMetrics[fqName] = append(vs, v)
-		return
 	}
-	t.ch <- t.newConstMetric(fqName, reportTime, labelKeys, metricValueType, metricValue, labelValues)
+	return startTime
+}
+
+// deltasAccumulated tells whether the points of a Time Series are
+// accumulated into a running total across scrapes.
+func (t *TimeSeriesMetrics) deltasAccumulated(timeSeries *monitoring.TimeSeries) bool {
+	metricKind := timeSeries.MetricKind
+	if metricKind == "" {
+		metricKind = t.metricDescriptor.MetricKind
+	}
+	return t.accumulateDeltas && metricKind == "DELTA"
 }
 
 func (t *TimeSeriesMetrics) newConstMetric(fqName string, reportTime time.Time, labelKeys []string, metricValueType prometheus.ValueType, metricValue float64, labelValues []string) prometheus.Metric {
-	return prometheus.NewMetricWithTimestamp(
+	return t.withReportTime(
 		reportTime,
 		prometheus.MustNewConstMetric(
 			t.newMetricDesc(fqName, labelKeys),
@@ -145,6 +322,15 @@ func (t *TimeSeriesMetrics) newConstMetric(fqName string, reportTime time.Time,
 	)
 }
 
+// withReportTime stamps the metric with the end time of its point, unless
+// timestamps are disabled and the scrape time should be used instead.
+func (t *TimeSeriesMetrics) withReportTime(reportTime time.Time, metric prometheus.Metric) prometheus.Metric {
+	if !t.withTimestamp {
+		return metric
+	}
+	return prometheus.NewMetricWithTimestamp(reportTime, metric)
+}
+
 func hashLabelKeys(labelKeys []string) uint64 {
 	dh := hashNew()
 	sortedKeys := make([]string, len(labelKeys))
@@ -157,6 +343,85 @@ func hashLabelKeys(labelKeys []string) uint64 {
 	return dh
 }
 
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// withDescriptorLabels returns the metric labels of a series including every
+// label of its metric descriptor, empty when missing, so the label set of the
+// metric does not change across scrapes when some series lack a label.
+func withDescriptorLabels(descriptor *monitoring.MetricDescriptor, labels map[string]string) map[string]string {
+	if len(descriptor.Labels) == 0 {
+		return labels
+	}
+	result := make(map[string]string, len(labels)+len(descriptor.Labels))
+	for _, label := range descriptor.Labels {
+		result[label.Key] = ""
+	}
+	for key, value := range labels {
+		result[key] = value
+	}
+	return result
+}
+
+// appendLabel appends a label pair, adding the prefix to the key if it is
+// already in use. The label is dropped if the prefixed key is in use too.
+func appendLabel(labelKeys []string, labelValues []string, prefix string, key string, value string) ([]string, []string) {
+	for _, candidate := range []string{key, prefix + key} {
+		if !hasLabelKey(labelKeys, candidate) {
+			return append(labelKeys, candidate), append(labelValues, value)
+		}
+	}
+	return labelKeys, labelValues
+}
+
+// dropEmptyLabels returns the label pairs with a non empty value.
+func dropEmptyLabels(labelKeys []string, labelValues []string) ([]string, []string) {
+	keys := make([]string, 0, len(labelKeys))
+	values := make([]string, 0, len(labelValues))
+	for i, value := range labelValues {
+		if value != "" {
+			keys = append(keys, labelKeys[i])
+			values = append(values, value)
+		}
+	}
+	return keys, values
+}
+
+func hasLabelKey(labelKeys []string, key string) bool {
+	for _, labelKey := range labelKeys {
+		if labelKey == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hashSeries identifies a time series by its metric type, monitored resource
+// type and label pairs, regardless of the label order.
+func hashSeries(metricType string, resourceType string, labelKeys []string, labelValues []string) uint64 {
+	labels := make([]string, len(labelKeys))
+	for i, key := range labelKeys {
+		labels[i] = key + "=" + labelValues[i]
+	}
+	sort.Strings(labels)
+
+	h := hashNew()
+	h = hashAdd(h, metricType)
+	h = hashAddByte(h, separatorByte)
+	h = hashAdd(h, resourceType)
+	for _, label := range labels {
+		h = hashAddByte(h, separatorByte)
+		h = hashAdd(h, label)
+	}
+	return h
+}
+
 func (t *TimeSeriesMetrics) Complete() {
 	t.completeConstMetrics()
 	t.completeHistogramMetrics()
@@ -177,7 +442,7 @@ func (t *TimeSeriesMetrics) completeConstMetrics() {
 		}
 
 		for _, v := range vs {
-			t.ch <- t.newConstMetric(v.fqName, v.reportTime, v.labelKeys, v.valueType, v.value, v.labelValues)
+			t.reportConstMetric(v)
 		}
 	}
 }
@@ -196,7 +461,7 @@ func (t *TimeSeriesMetrics) completeHistogramMetrics() {
 			}
 		}
 		for _, v := range vs {
-			t.ch <- t.newConstHistogram(v.fqName, v.reportTime, v.labelKeys, v.dist, v.buckets, v.labelValues)
+			t.reportHistogramMetric(v)
 		}
 	}
 }
@@ -0,0 +1,26 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("buildFQName", func() {
+	It("prefixes the metric name with the namespace and the monitored resource type", func() {
+		t := &TimeSeriesMetrics{namespace: "gcp"}
+		Expect(t.buildFQName(int64TimeSeries(nil, nil, 1), "")).To(Equal("gcp_gce_instance_compute_googleapis_com_instance_cpu_utilization"))
+	})
+})
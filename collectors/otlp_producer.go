@@ -0,0 +1,301 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"golang.org/x/net/context"
+)
+
+// otlpScopeName is the instrumentation scope of the metrics pushed over OTLP.
+const otlpScopeName = "github.com/prometheus-community/stackdriver_exporter"
+
+// OTLPProducer produces the Time Series reported by collectors for an
+// OpenTelemetry SDK reader, ie to push them to an OTLP endpoint with a
+// PeriodicReader.
+//
+// The Time Series are translated from the ones reported by the scrapes of the
+// collectors, so a collector serving both scrapes and pushes calls the API
+// once: counters become cumulative monotonic sums, DISTRIBUTION metrics
+// cumulative histograms and the other metrics gauges, with the labels as
+// attributes. Their start time is the start of their newest point, or of the
+// running total of accumulated DELTA metrics. The collector metrics are only
+// served for scraping.
+type OTLPProducer struct {
+	collectors []*MonitoringCollector
+	interval   time.Duration
+}
+
+// NewOTLPProducer returns a producer of the Time Series reported by the
+// collectors. A collector not scraped within the interval is scraped when
+// producing. It must be called before the collectors are registered.
+func NewOTLPProducer(collectors []*MonitoringCollector, interval time.Duration) *OTLPProducer {
+	for _, c := range collectors {
+		if c.otlpRecorder == nil {
+			c.otlpRecorder = newOTLPRecorder()
+		}
+	}
+	return &OTLPProducer{collectors: collectors, interval: interval}
+}
+
+// Produce returns the Time Series reported by the newest scrape of every
+// collector. The scrape errors are logged by the collectors, and the Time
+// Series collected so far are still returned.
+func (p *OTLPProducer) Produce(ctx context.Context) ([]metricdata.ScopeMetrics, error) {
+	var metrics []metricdata.Metrics
+	for _, c := range p.collectors {
+		if time.Since(c.otlpRecorder.lastScrape()) >= p.interval {
+			ch := make(chan prometheus.Metric)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for range ch {
+				}
+			}()
+			c.collect(ctx, nil, ch)
+			close(ch)
+			<-done
+		}
+		metrics = append(metrics, c.otlpRecorder.metrics()...)
+	}
+	if len(metrics) == 0 {
+		return nil, nil
+	}
+	return []metricdata.ScopeMetrics{{
+		Scope:   instrumentation.Scope{Name: otlpScopeName},
+		Metrics: metrics,
+	}}, nil
+}
+
+// otlpStreamKey identifies a stream by its metric name and attributes.
+type otlpStreamKey struct {
+	name       string
+	attributes attribute.Distinct
+}
+
+// otlpStream is the newest point of a stream.
+type otlpStream struct {
+	name       string
+	help       string
+	attributes attribute.Set
+	valueType  prometheus.ValueType
+	histogram  bool
+	value      float64
+	count      uint64
+	sum        float64
+	buckets    map[float64]uint64
+	startTime  time.Time
+	time       time.Time
+	updated    time.Time
+}
+
+// otlpRecorder keeps the newest point of every stream reported by the scrapes
+// of a collector, until a full scrape no longer reports it.
+type otlpRecorder struct {
+	mu              sync.Mutex
+	streams         map[otlpStreamKey]*otlpStream
+	lastScrapeEnded time.Time
+}
+
+func newOTLPRecorder() *otlpRecorder {
+	return &otlpRecorder{streams: make(map[otlpStreamKey]*otlpStream)}
+}
+
+func (r *otlpRecorder) recordConstMetric(help string, constLabels prometheus.Labels, v ConstMetric) {
+	r.record(&otlpStream{
+		name:       v.fqName,
+		help:       help,
+		attributes: otlpAttributes(v.labelKeys, v.labelValues, constLabels),
+		valueType:  v.valueType,
+		value:      v.value,
+		startTime:  v.startTime,
+		time:       v.reportTime,
+	}, v.accumulated)
+}
+
+func (r *otlpRecorder) recordHistogram(help string, constLabels prometheus.Labels, v HistogramMetric) {
+	r.record(&otlpStream{
+		name:       v.fqName,
+		help:       help,
+		attributes: otlpAttributes(v.labelKeys, v.labelValues, constLabels),
+		histogram:  true,
+		count:      v.count,
+		sum:        v.sum,
+		buckets:    v.buckets,
+		startTime:  v.startTime,
+		time:       v.reportTime,
+	}, v.accumulated)
+}
+
+// record replaces the point of a stream. The start time first seen is kept
+// for the running totals of accumulated DELTA metrics.
+func (r *otlpRecorder) record(stream *otlpStream, accumulated bool) {
+	key := otlpStreamKey{name: stream.name, attributes: stream.attributes.Equivalent()}
+	stream.updated = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if previous, ok := r.streams[key]; ok && accumulated && !previous.startTime.IsZero() && previous.startTime.Before(stream.startTime) {
+		stream.startTime = previous.startTime
+	}
+	r.streams[key] = stream
+}
+
+// completeScrape marks the end of a scrape of every metric, and drops the
+// streams it did not report if it succeeded.
+func (r *otlpRecorder) completeScrape(begun time.Time, succeeded bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastScrapeEnded = time.Now()
+	if !succeeded {
+		return
+	}
+	for key, stream := range r.streams {
+		if stream.updated.Before(begun) {
+			delete(r.streams, key)
+		}
+	}
+}
+
+func (r *otlpRecorder) lastScrape() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastScrapeEnded
+}
+
+// metrics returns the recorded streams as OpenTelemetry metrics, sorted by
+// name.
+func (r *otlpRecorder) metrics() []metricdata.Metrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byName := make(map[string][]*otlpStream)
+	for _, stream := range r.streams {
+		byName[stream.name] = append(byName[stream.name], stream)
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	metrics := make([]metricdata.Metrics, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, otlpMetric(byName[name]))
+	}
+	return metrics
+}
+
+// otlpMetric translates the streams of a metric. The streams of a metric
+// share its kind, as they are reported from the same Metric Descriptor.
+func otlpMetric(streams []*otlpStream) metricdata.Metrics {
+	first := streams[0]
+	metric := metricdata.Metrics{Name: first.name, Description: first.help}
+	switch {
+	case first.histogram:
+		points := make([]metricdata.HistogramDataPoint[float64], 0, len(streams))
+		for _, stream := range streams {
+			bounds, counts := otlpBuckets(stream.count, stream.buckets)
+			points = append(points, metricdata.HistogramDataPoint[float64]{
+				Attributes:   stream.attributes,
+				StartTime:    stream.startTime,
+				Time:         stream.time,
+				Count:        stream.count,
+				Sum:          stream.sum,
+				Bounds:       bounds,
+				BucketCounts: counts,
+			})
+		}
+		metric.Data = metricdata.Histogram[float64]{
+			DataPoints:  points,
+			Temporality: metricdata.CumulativeTemporality,
+		}
+	case first.valueType == prometheus.CounterValue:
+		metric.Data = metricdata.Sum[float64]{
+			DataPoints:  otlpDataPoints(streams),
+			Temporality: metricdata.CumulativeTemporality,
+			IsMonotonic: true,
+		}
+	default:
+		metric.Data = metricdata.Gauge[float64]{DataPoints: otlpDataPoints(streams)}
+	}
+	return metric
+}
+
+func otlpDataPoints(streams []*otlpStream) []metricdata.DataPoint[float64] {
+	points := make([]metricdata.DataPoint[float64], 0, len(streams))
+	for _, stream := range streams {
+		points = append(points, metricdata.DataPoint[float64]{
+			Attributes: stream.attributes,
+			StartTime:  stream.startTime,
+			Time:       stream.time,
+			Value:      stream.value,
+		})
+	}
+	return points
+}
+
+// otlpBuckets turns the cumulative counts of Prometheus buckets, keyed by
+// upper bound, into OTLP explicit bounds and the count of every bucket,
+// including the overflow bucket.
+func otlpBuckets(count uint64, buckets map[float64]uint64) ([]float64, []uint64) {
+	bounds := make([]float64, 0, len(buckets))
+	for bound := range buckets {
+		if !math.IsInf(bound, 1) {
+			bounds = append(bounds, bound)
+		}
+	}
+	sort.Float64s(bounds)
+
+	counts := make([]uint64, 0, len(bounds)+1)
+	var cumulative uint64
+	for _, bound := range bounds {
+		counts = append(counts, bucketDifference(buckets[bound], cumulative))
+		if buckets[bound] > cumulative {
+			cumulative = buckets[bound]
+		}
+	}
+	return bounds, append(counts, bucketDifference(count, cumulative))
+}
+
+// bucketDifference returns the count of a bucket from the cumulative counts
+// of its upper and lower bounds, clamped to 0 as malformed points may report
+// decreasing cumulative counts.
+func bucketDifference(upper uint64, lower uint64) uint64 {
+	if upper < lower {
+		return 0
+	}
+	return upper - lower
+}
+
+// otlpAttributes returns the labels of a metric as attributes, renaming the
+// label keys colliding with a const label as the scraped metrics do.
+func otlpAttributes(labelKeys []string, labelValues []string, constLabels prometheus.Labels) attribute.Set {
+	attributes := make([]attribute.KeyValue, 0, len(labelKeys)+len(constLabels))
+	for i, key := range exportedLabelKeys(labelKeys, constLabels) {
+		attributes = append(attributes, attribute.String(key, labelValues[i]))
+	}
+	for key, value := range constLabels {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return attribute.NewSet(attributes...)
+}
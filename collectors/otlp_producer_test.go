@@ -0,0 +1,158 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"golang.org/x/net/context"
+	"google.golang.org/api/monitoring/v3"
+)
+
+var _ = Describe("OTLPProducer", func() {
+	var c *MonitoringCollector
+
+	BeforeEach(func() {
+		c = newTestCollector()
+		c.otlpRecorder = newOTLPRecorder()
+	})
+
+	// produce returns the metrics of the recorded streams, without scraping.
+	produce := func() []metricdata.Metrics {
+		c.otlpRecorder.completeScrape(time.Unix(0, 0), false)
+		scopeMetrics, err := NewOTLPProducer([]*MonitoringCollector{c}, time.Hour).Produce(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(scopeMetrics).To(HaveLen(1))
+		return scopeMetrics[0].Metrics
+	}
+
+	It("translates CUMULATIVE Time Series into monotonic sums starting with their newest point", func() {
+		descriptor := &monitoring.MetricDescriptor{Type: testDescriptor.Type, MetricKind: "CUMULATIVE", ValueType: "INT64"}
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 3)
+		timeSeries.MetricKind = "CUMULATIVE"
+		timeSeries.Points[0].Interval.StartTime = "2019-12-31T00:00:00Z"
+
+		c.extraLabels = prometheus.Labels{"env": "prod"}
+		reportTimeSeries(c, descriptor, timeSeries)
+
+		metrics := produce()
+		Expect(metrics).To(HaveLen(1))
+		sum, ok := metrics[0].Data.(metricdata.Sum[float64])
+		Expect(ok).To(BeTrue())
+		Expect(sum.IsMonotonic).To(BeTrue())
+		Expect(sum.Temporality).To(Equal(metricdata.CumulativeTemporality))
+		Expect(sum.DataPoints).To(HaveLen(1))
+		Expect(sum.DataPoints[0].Value).To(Equal(float64(3)))
+		Expect(sum.DataPoints[0].StartTime).To(Equal(time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)))
+		Expect(sum.DataPoints[0].Time).To(Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(sum.DataPoints[0].Attributes.HasValue("instance_id")).To(BeTrue())
+		Expect(sum.DataPoints[0].Attributes.HasValue("env")).To(BeTrue())
+	})
+
+	It("translates GAUGE Time Series into gauges", func() {
+		reportTimeSeries(c, testDescriptor, int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1))
+
+		metrics := produce()
+		Expect(metrics).To(HaveLen(1))
+		Expect(metrics[0].Name).To(Equal("stackdriver_gce_instance_compute_googleapis_com_instance_cpu_utilization"))
+		Expect(metrics[0].Description).To(Equal("CPU utilization."))
+		_, ok := metrics[0].Data.(metricdata.Gauge[float64])
+		Expect(ok).To(BeTrue())
+	})
+
+	It("keeps the start time of the running total of accumulated DELTA Time Series", func() {
+		descriptor := &monitoring.MetricDescriptor{Type: testDescriptor.Type, MetricKind: "DELTA", ValueType: "INT64"}
+		deltaTimeSeries := func(startTime, endTime string) *monitoring.TimeSeries {
+			timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1)
+			timeSeries.MetricKind = "DELTA"
+			timeSeries.Points[0].Interval = &monitoring.TimeInterval{StartTime: startTime, EndTime: endTime}
+			return timeSeries
+		}
+
+		c.deltaCounters = newDeltaCounterStore(time.Hour, 0)
+		reportTimeSeries(c, descriptor, deltaTimeSeries("2020-01-01T00:00:00Z", "2020-01-01T00:01:00Z"))
+		reportTimeSeries(c, descriptor, deltaTimeSeries("2020-01-01T00:01:00Z", "2020-01-01T00:02:00Z"))
+
+		sum := produce()[0].Data.(metricdata.Sum[float64])
+		Expect(sum.DataPoints[0].Value).To(Equal(float64(2)))
+		Expect(sum.DataPoints[0].StartTime).To(Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)))
+		Expect(sum.DataPoints[0].Time).To(Equal(time.Date(2020, 1, 1, 0, 2, 0, 0, time.UTC)))
+	})
+
+	It("translates distributions into histograms with the count of each bucket", func() {
+		descriptor := &monitoring.MetricDescriptor{Type: testDescriptor.Type, MetricKind: "CUMULATIVE", ValueType: "DISTRIBUTION"}
+		timeSeries := int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 0)
+		timeSeries.MetricKind, timeSeries.ValueType = "CUMULATIVE", "DISTRIBUTION"
+		timeSeries.Points[0].Interval.StartTime = "2019-12-31T00:00:00Z"
+		timeSeries.Points[0].Value = &monitoring.TypedValue{DistributionValue: &monitoring.Distribution{
+			Count:        6,
+			Mean:         2,
+			BucketCounts: []int64{1, 3, 2},
+			BucketOptions: &monitoring.BucketOptions{
+				ExplicitBuckets: &monitoring.Explicit{Bounds: []float64{1, 5}},
+			},
+		}}
+		reportTimeSeries(c, descriptor, timeSeries)
+
+		histogram, ok := produce()[0].Data.(metricdata.Histogram[float64])
+		Expect(ok).To(BeTrue())
+		Expect(histogram.Temporality).To(Equal(metricdata.CumulativeTemporality))
+		point := histogram.DataPoints[0]
+		Expect(point.Count).To(Equal(uint64(6)))
+		Expect(point.Sum).To(Equal(float64(12)))
+		Expect(point.Bounds).To(Equal([]float64{1, 5}))
+		Expect(point.BucketCounts).To(Equal([]uint64{1, 3, 2}))
+		Expect(point.StartTime).To(Equal(time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("drops the streams a successful scrape did not report", func() {
+		reportTimeSeries(c, testDescriptor, int64TimeSeries(nil, map[string]string{"instance_id": "1"}, 1))
+		c.otlpRecorder.completeScrape(time.Now(), false)
+		Expect(c.otlpRecorder.metrics()).To(HaveLen(1))
+
+		c.otlpRecorder.completeScrape(time.Now(), true)
+		Expect(c.otlpRecorder.metrics()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("otlpBuckets", func() {
+	It("returns the finite bounds and the count of every bucket", func() {
+		bounds, counts := otlpBuckets(6, map[float64]uint64{10: 1, 20: 3, math.Inf(1): 6})
+		Expect(bounds).To(Equal([]float64{10, 20}))
+		Expect(counts).To(Equal([]uint64{1, 2, 3}))
+	})
+
+	It("clamps the counts of decreasing cumulative buckets to 0", func() {
+		bounds, counts := otlpBuckets(2, map[float64]uint64{10: 3, 20: 1, math.Inf(1): 2})
+		Expect(bounds).To(Equal([]float64{10, 20}))
+		Expect(counts).To(Equal([]uint64{3, 0, 0}))
+	})
+})
+
+var _ = Describe("otlpAttributes", func() {
+	It("adds the const labels and renames the colliding labels", func() {
+		attributes := otlpAttributes([]string{"env", "zone"}, []string{"dev", "us-central1-a"}, prometheus.Labels{"env": "prod"})
+		Expect(attributes.ToSlice()).To(ConsistOf(
+			attribute.String("env", "prod"),
+			attribute.String("exported_env", "dev"),
+			attribute.String("zone", "us-central1-a"),
+		))
+	})
+})
@@ -0,0 +1,136 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+	"google.golang.org/api/monitoring/v3"
+
+	"github.com/prometheus-community/stackdriver_exporter/utils"
+)
+
+// reportQueryMetrics runs a named Monitoring Query Language query and reports
+// its result table.
+// @see https://cloud.google.com/monitoring/mql
+func (c *MonitoringCollector) reportQueryMetrics(ctx context.Context, name string, query string, ch chan<- prometheus.Metric) error {
+	level.Debug(c.logger).Log("msg", "running Google Stackdriver Monitoring query", "query", name)
+	request := &monitoring.QueryTimeSeriesRequest{Query: query, PageSize: c.pageSize}
+	for {
+		var page *monitoring.QueryTimeSeriesResponse
+		err := c.workers.Do(ctx, func() error {
+			c.apiCallsTotalMetric.Inc()
+			requestCtx, cancel := c.requestContext(ctx)
+			defer cancel()
+			defer c.observeAPICall("timeSeries.query", time.Now())
+			var err error
+			page, err = c.monitoringService.Projects.TimeSeries.Query(utils.ScopeResource(c.projectID), request).Context(requestCtx).Do()
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Error running query %s: %v", name, err)
+		}
+		c.reportQueryPage(name, page, ch)
+		if page.NextPageToken == "" {
+			return nil
+		}
+		request.PageToken = page.NextPageToken
+	}
+}
+
+// reportQueryPage reports each point column of a query result table as a
+// metric named after the query and the column, labeled with the table labels.
+func (c *MonitoringCollector) reportQueryPage(name string, page *monitoring.QueryTimeSeriesResponse, ch chan<- prometheus.Metric) {
+	if page.TimeSeriesDescriptor == nil {
+		return
+	}
+	labelDescriptors := page.TimeSeriesDescriptor.LabelDescriptors
+	pointDescriptors := page.TimeSeriesDescriptor.PointDescriptors
+
+	for _, data := range page.TimeSeriesData {
+		var labelKeys, labelValues []string
+		for i, labelDescriptor := range labelDescriptors {
+			if i >= len(data.LabelValues) {
+				break
+			}
+			labelKeys, labelValues = appendLabel(labelKeys, labelValues, "label_", utils.NormalizeMetricName(labelDescriptor.Key), queryLabelValue(labelDescriptor, data.LabelValues[i]))
+		}
+
+		// Only the most recent point is reported, as for Time Series
+		var newestPoint *monitoring.PointData
+		newestEndTime := time.Unix(0, 0)
+		for _, point := range data.PointData {
+			if point.TimeInterval == nil {
+				continue
+			}
+			endTime, err := time.Parse(time.RFC3339Nano, point.TimeInterval.EndTime)
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "discarding query point with invalid end time", "query", name, "err", err)
+				continue
+			}
+			if endTime.After(newestEndTime) {
+				newestEndTime = endTime
+				newestPoint = point
+			}
+		}
+		if newestPoint == nil {
+			continue
+		}
+
+		for i, pointDescriptor := range pointDescriptors {
+			if i >= len(newestPoint.Values) {
+				break
+			}
+			value, ok := pointValue(pointDescriptor.ValueType, &monitoring.Point{Value: newestPoint.Values[i]})
+			if !ok {
+				level.Debug(c.logger).Log("msg", "discarding", "query", name, "column", pointDescriptor.Key, "value_type", pointDescriptor.ValueType)
+				continue
+			}
+			valueType := prometheus.GaugeValue
+			if pointDescriptor.MetricKind == "CUMULATIVE" {
+				valueType = prometheus.CounterValue
+			}
+
+			desc := prometheus.NewDesc(
+				prometheus.BuildFQName(c.namespace, "query", utils.NormalizeMetricName(name+"_"+pointDescriptor.Key)),
+				fmt.Sprintf("Column %s of the Google Stackdriver Monitoring query %s.", pointDescriptor.Key, name),
+				exportedLabelKeys(labelKeys, c.extraLabels),
+				c.extraLabels,
+			)
+			metric := prometheus.MustNewConstMetric(desc, valueType, value, labelValues...)
+			if c.collectorMetricsWithTimestamp {
+				metric = prometheus.NewMetricWithTimestamp(newestEndTime, metric)
+			}
+			ch <- metric
+		}
+	}
+}
+
+func queryLabelValue(descriptor *monitoring.LabelDescriptor, value *monitoring.LabelValue) string {
+	if value == nil {
+		return ""
+	}
+	switch descriptor.ValueType {
+	case "BOOL":
+		return strconv.FormatBool(value.BoolValue)
+	case "INT64":
+		return strconv.FormatInt(value.Int64Value, 10)
+	}
+	return value.StringValue
+}
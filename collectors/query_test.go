@@ -0,0 +1,71 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"github.com/go-kit/kit/log"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/api/monitoring/v3"
+)
+
+var _ = Describe("reportQueryPage", func() {
+	It("reports the newest point of each column", func() {
+		c := &MonitoringCollector{namespace: "stackdriver", logger: log.NewNopLogger()}
+		oldValue, newValue := 1.0, 2.0
+		page := &monitoring.QueryTimeSeriesResponse{
+			TimeSeriesDescriptor: &monitoring.TimeSeriesDescriptor{
+				LabelDescriptors: []*monitoring.LabelDescriptor{
+					{Key: "resource.zone", ValueType: "STRING"},
+					{Key: "metric.instance_id", ValueType: "INT64"},
+				},
+				PointDescriptors: []*monitoring.ValueDescriptor{
+					{Key: "value.utilization", MetricKind: "GAUGE", ValueType: "DOUBLE"},
+				},
+			},
+			TimeSeriesData: []*monitoring.TimeSeriesData{
+				{
+					LabelValues: []*monitoring.LabelValue{{StringValue: "us-central1-a"}, {Int64Value: 1}},
+					PointData: []*monitoring.PointData{
+						{
+							TimeInterval: &monitoring.TimeInterval{EndTime: "2020-01-01T00:00:00Z"},
+							Values:       []*monitoring.TypedValue{{DoubleValue: &oldValue}},
+						},
+						{
+							TimeInterval: &monitoring.TimeInterval{EndTime: "2020-01-01T00:01:00Z"},
+							Values:       []*monitoring.TypedValue{{DoubleValue: &newValue}},
+						},
+					},
+				},
+			},
+		}
+
+		ch := make(chan prometheus.Metric, 10)
+		c.reportQueryPage("cpu", page, ch)
+		close(ch)
+
+		Expect(ch).To(HaveLen(1))
+		metric := <-ch
+		Expect(metric.Desc().String()).To(ContainSubstring(`fqName: "stackdriver_query_cpu_value_utilization"`))
+		m := &dto.Metric{}
+		Expect(metric.Write(m)).To(Succeed())
+		Expect(m.GetGauge().GetValue()).To(Equal(newValue))
+		Expect(metricLabels(m)).To(Equal(map[string]string{
+			"resource_zone":      "us-central1-a",
+			"metric_instance_id": "1",
+		}))
+	})
+})
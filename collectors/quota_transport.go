@@ -0,0 +1,112 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Response headers carrying the remaining API quota, and the number of
+// seconds until it is reset (or the reset Unix time, for large values).
+var (
+	quotaRemainingHeaders = []string{"X-Goog-Quota-Remaining", "X-RateLimit-Remaining"}
+	quotaResetHeaders     = []string{"X-Goog-Quota-Reset", "X-RateLimit-Reset", "Retry-After"}
+)
+
+// QuotaTransport is an http.RoundTripper recording the API quota reported in
+// the Google Stackdriver Monitoring API response headers, and a collector
+// exporting it. Nothing is exported until a response carries quota headers.
+type QuotaTransport struct {
+	next          http.RoundTripper
+	lock          sync.Mutex
+	remaining     *float64
+	reset         *float64
+	remainingDesc *prometheus.Desc
+	resetDesc     *prometheus.Desc
+}
+
+func NewQuotaTransport(next http.RoundTripper) *QuotaTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &QuotaTransport{
+		next: next,
+		remainingDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(*collectorNamespace, *collectorSubsystem, "api_quota_remaining"),
+			"Remaining Google Stackdriver Monitoring API quota, as reported by the last response carrying it.",
+			nil, nil,
+		),
+		resetDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(*collectorNamespace, *collectorSubsystem, "api_quota_reset_timestamp_seconds"),
+			"Unix time when the Google Stackdriver Monitoring API quota is reset, as reported by the last response carrying it.",
+			nil, nil,
+		),
+	}
+}
+
+func (t *QuotaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.record(resp.Header, time.Now())
+	}
+	return resp, err
+}
+
+func (t *QuotaTransport) record(header http.Header, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if remaining, ok := headerValue(header, quotaRemainingHeaders); ok {
+		t.remaining = &remaining
+	}
+	if reset, ok := headerValue(header, quotaResetHeaders); ok {
+		// Small values are a number of seconds from now
+		if reset < 1e9 {
+			reset += float64(now.Unix())
+		}
+		t.reset = &reset
+	}
+}
+
+// headerValue returns the value of the first of the headers set to a number.
+func headerValue(header http.Header, names []string) (float64, bool) {
+	for _, name := range names {
+		if value, err := strconv.ParseFloat(header.Get(name), 64); err == nil {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+func (t *QuotaTransport) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.remainingDesc
+	ch <- t.resetDesc
+}
+
+func (t *QuotaTransport) Collect(ch chan<- prometheus.Metric) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.remaining != nil {
+		ch <- prometheus.MustNewConstMetric(t.remainingDesc, prometheus.GaugeValue, *t.remaining)
+	}
+	if t.reset != nil {
+		ch <- prometheus.MustNewConstMetric(t.resetDesc, prometheus.GaugeValue, *t.reset)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QuotaTransport", func() {
+	var transport *QuotaTransport
+
+	BeforeEach(func() {
+		transport = &QuotaTransport{}
+	})
+
+	It("records nothing without quota headers", func() {
+		transport.record(http.Header{}, time.Unix(1600000000, 0))
+		Expect(transport.remaining).To(BeNil())
+		Expect(transport.reset).To(BeNil())
+	})
+
+	It("records the remaining quota and its reset time", func() {
+		header := http.Header{}
+		header.Set("X-RateLimit-Remaining", "42")
+		header.Set("Retry-After", "30")
+		transport.record(header, time.Unix(1600000000, 0))
+		Expect(*transport.remaining).To(Equal(float64(42)))
+		Expect(*transport.reset).To(Equal(float64(1600000030)))
+	})
+
+	It("records reset Unix times as is", func() {
+		header := http.Header{}
+		header.Set("X-RateLimit-Reset", "1600000060")
+		transport.record(header, time.Unix(1600000000, 0))
+		Expect(*transport.reset).To(Equal(float64(1600000060)))
+	})
+})
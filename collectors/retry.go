@@ -0,0 +1,125 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/PuerkitoBio/rehttp"
+	"golang.org/x/net/context"
+	"google.golang.org/api/googleapi"
+)
+
+func isPermissionDeniedError(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == http.StatusForbidden
+	}
+	return false
+}
+
+// errorReasons are the reasons scrape errors are classified into.
+var errorReasons = []string{"auth", "quota", "timeout", "parse", "other"}
+
+// errorReason classifies an error by its Google API status code or type.
+func errorReason(err error) string {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return "auth"
+		case http.StatusTooManyRequests:
+			return "quota"
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return "timeout"
+		}
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return "timeout"
+	}
+	var parseErr *PointParseError
+	if errors.As(err, &parseErr) {
+		return "parse"
+	}
+	return "other"
+}
+
+// scrapeErrorReasons returns the distinct reasons of the errors of a scrape.
+func scrapeErrorReasons(err error) []string {
+	errs, ok := err.(scrapeErrors)
+	if !ok {
+		return []string{errorReason(err)}
+	}
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, err := range errs {
+		if reason := errorReason(err); !seen[reason] {
+			seen[reason] = true
+			reasons = append(reasons, reason)
+		}
+	}
+	return reasons
+}
+
+// NewRetryTransport returns an http.RoundTripper retrying the Google
+// Stackdriver Monitoring API requests answered with one of the given transient
+// statuses, up to the max number of retries. Retries are delayed with a
+// jittered exponential backoff from the base delay, capped at the max delay.
+//
+// Every API call goes through the transport, so retrying there covers all of
+// them without the collector retrying on top.
+func NewRetryTransport(next http.RoundTripper, maxRetries int, statuses []int, baseDelay time.Duration, maxDelay time.Duration) http.RoundTripper {
+	return rehttp.NewTransport(
+		next,
+		rehttp.RetryAll(
+			rehttp.RetryMaxRetries(maxRetries),
+			rehttp.RetryStatuses(statuses...),
+		),
+		func(attempt rehttp.Attempt) time.Duration {
+			return backoffDelay(baseDelay, maxDelay, attempt.Index)
+		},
+	)
+}
+
+// backoffDelay returns the exponential backoff delay for the given attempt,
+// capped at the max delay, with half of it randomized to avoid retrying in
+// lockstep.
+func backoffDelay(base time.Duration, max time.Duration, attempt int) time.Duration {
+	delay := base << uint(attempt)
+	if delay>>uint(attempt) != base {
+		// Shifted out of range
+		delay = time.Duration(math.MaxInt64)
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// jitterDelay returns a random delay up to the given max.
+func jitterDelay(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
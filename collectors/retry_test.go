@@ -0,0 +1,82 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("NewRetryTransport", func() {
+	statuses := []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable}
+
+	table.DescribeTable("retries the transient statuses only",
+		func(status int, expectedAttempts int) {
+			attempts := 0
+			transport := NewRetryTransport(roundTripperFunc(func(*http.Request) (*http.Response, error) {
+				attempts++
+				return &http.Response{StatusCode: status, Body: ioutil.NopCloser(bytes.NewReader(nil))}, nil
+			}), 2, statuses, time.Nanosecond, time.Nanosecond)
+
+			req, _ := http.NewRequest(http.MethodGet, "https://monitoring.googleapis.com/", nil)
+			resp, err := transport.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(status))
+			Expect(attempts).To(Equal(expectedAttempts))
+		},
+		table.Entry("200", http.StatusOK, 1),
+		table.Entry("403", http.StatusForbidden, 1),
+		table.Entry("404", http.StatusNotFound, 1),
+		table.Entry("429", http.StatusTooManyRequests, 3),
+		table.Entry("500", http.StatusInternalServerError, 3),
+		table.Entry("502", http.StatusBadGateway, 1),
+		table.Entry("503", http.StatusServiceUnavailable, 3),
+	)
+})
+
+var _ = Describe("backoffDelay", func() {
+	table.DescribeTable("doubles the delay on every attempt, half of it randomized",
+		func(base time.Duration, max time.Duration, attempt int, min time.Duration, upper time.Duration) {
+			for i := 0; i < 100; i++ {
+				delay := backoffDelay(base, max, attempt)
+				Expect(delay).To(BeNumerically(">=", min))
+				Expect(delay).To(BeNumerically("<", upper))
+			}
+		},
+		table.Entry("first attempt", time.Second, time.Minute, 0, 500*time.Millisecond, time.Second),
+		table.Entry("third attempt", time.Second, time.Minute, 2, 2*time.Second, 4*time.Second),
+		table.Entry("capped at the max delay", time.Second, 5*time.Second, 10, 2500*time.Millisecond, 5*time.Second),
+		table.Entry("capped when the shift overflows", time.Second, 5*time.Second, 70, 2500*time.Millisecond, 5*time.Second),
+		table.Entry("uncapped without a max delay", time.Second, time.Duration(0), 3, 4*time.Second, 8*time.Second),
+		table.Entry("uncapped when the shift overflows without a max delay", time.Second, time.Duration(0), 70, time.Duration(math.MaxInt64/2), time.Duration(math.MaxInt64)),
+	)
+
+	It("returns tiny delays as is", func() {
+		Expect(backoffDelay(1, 0, 0)).To(Equal(time.Duration(1)))
+		Expect(backoffDelay(0, 0, 3)).To(Equal(time.Duration(0)))
+	})
+})
@@ -0,0 +1,85 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/context"
+)
+
+// workerPool bounds the number of tasks running at the same time. A pool
+// without workers runs every task as soon as it is submitted.
+//
+// Tasks must not submit other tasks to the same pool and wait for them, as
+// they could wait forever for a worker held by themselves.
+type workerPool struct {
+	workers     chan struct{}
+	waitSeconds prometheus.Observer
+}
+
+// newWorkerPool returns a pool of workers, observing how long tasks wait for
+// a free worker if an observer is given.
+func newWorkerPool(size int, waitSeconds prometheus.Observer) *workerPool {
+	pool := &workerPool{waitSeconds: waitSeconds}
+	if size > 0 {
+		pool.workers = make(chan struct{}, size)
+	}
+	return pool
+}
+
+func (p *workerPool) acquire(ctx context.Context) error {
+	if p.workers == nil {
+		return nil
+	}
+	begun := time.Now()
+	select {
+	case p.workers <- struct{}{}:
+		if p.waitSeconds != nil {
+			p.waitSeconds.Observe(time.Since(begun).Seconds())
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *workerPool) release() {
+	if p.workers != nil {
+		<-p.workers
+	}
+}
+
+// Do runs the task in the calling goroutine once a worker is free.
+func (p *workerPool) Do(ctx context.Context, task func() error) error {
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	defer p.release()
+	return task()
+}
+
+// Go runs the task in a new goroutine once a worker is free. It only blocks
+// until the task is started, and fails if the context is done before that.
+func (p *workerPool) Go(ctx context.Context, task func()) error {
+	if err := p.acquire(ctx); err != nil {
+		return err
+	}
+	go func() {
+		defer p.release()
+		task()
+	}()
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collectors
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"golang.org/x/net/context"
+)
+
+var _ = Describe("workerPool", func() {
+	It("runs tasks without workers", func() {
+		pool := newWorkerPool(0, nil)
+		Expect(pool.Do(context.Background(), func() error { return errors.New("failed") })).To(MatchError("failed"))
+
+		done := make(chan struct{})
+		Expect(pool.Go(context.Background(), func() { close(done) })).To(Succeed())
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("bounds the number of running tasks", func() {
+		pool := newWorkerPool(2, nil)
+		var running int32
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				Expect(pool.Do(context.Background(), func() error {
+					atomic.AddInt32(&running, 1)
+					defer atomic.AddInt32(&running, -1)
+					<-release
+					return nil
+				})).To(Succeed())
+			}()
+		}
+
+		load := func() int32 { return atomic.LoadInt32(&running) }
+		Eventually(load).Should(Equal(int32(2)))
+		Consistently(load, 100*time.Millisecond).Should(Equal(int32(2)))
+		close(release)
+		wg.Wait()
+		Expect(load()).To(Equal(int32(0)))
+	})
+
+	It("fails to start tasks once the context is done", func() {
+		pool := newWorkerPool(1, nil)
+		release := make(chan struct{})
+		Expect(pool.Go(context.Background(), func() { <-release })).To(Succeed())
+		defer close(release)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(pool.Go(ctx, func() {})).To(MatchError(context.Canceled))
+		Expect(pool.Do(ctx, func() error { return nil })).To(MatchError(context.Canceled))
+	})
+
+	It("observes the time waited for a free worker", func() {
+		waitSeconds := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "request_wait_seconds"})
+		pool := newWorkerPool(1, waitSeconds)
+		Expect(pool.Do(context.Background(), func() error { return nil })).To(Succeed())
+		Expect(pool.Do(context.Background(), func() error { return nil })).To(Succeed())
+
+		metric := &dto.Metric{}
+		Expect(waitSeconds.Write(metric)).To(Succeed())
+		Expect(metric.GetHistogram().GetSampleCount()).To(Equal(uint64(2)))
+	})
+})
@@ -0,0 +1,68 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iamcredentials/v1"
+)
+
+// impersonatedTokenSource issues access tokens for a service account through
+// the IAM Credentials API, authenticating with the default credentials.
+type impersonatedTokenSource struct {
+	ctx            context.Context
+	service        *iamcredentials.Service
+	serviceAccount string
+	scopes         []string
+}
+
+func (ts *impersonatedTokenSource) Token() (*oauth2.Token, error) {
+	name := fmt.Sprintf("projects/-/serviceAccounts/%s", ts.serviceAccount)
+	request := &iamcredentials.GenerateAccessTokenRequest{Scope: ts.scopes}
+	response, err := ts.service.Projects.ServiceAccounts.GenerateAccessToken(name, request).Context(ts.ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("Error impersonating service account %s: %v", ts.serviceAccount, err)
+	}
+
+	expiry, err := time.Parse(time.RFC3339, response.ExpireTime)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing impersonated token expire time `%s`: %v", response.ExpireTime, err)
+	}
+
+	return &oauth2.Token{AccessToken: response.AccessToken, Expiry: expiry}, nil
+}
+
+// impersonatedClient returns an HTTP client authenticated as the given
+// service account. The default credentials must be allowed to create tokens
+// for it, e.g. with the `roles/iam.serviceAccountTokenCreator` IAM role.
+func impersonatedClient(ctx context.Context, serviceAccount string, scopes ...string) (*http.Client, error) {
+	service, err := iamcredentials.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Google IAM Credentials service: %v", err)
+	}
+
+	tokenSource := oauth2.ReuseTokenSource(nil, &impersonatedTokenSource{
+		ctx:            ctx,
+		service:        service,
+		serviceAccount: serviceAccount,
+		scopes:         scopes,
+	})
+
+	return oauth2.NewClient(ctx, tokenSource), nil
+}
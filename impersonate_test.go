@@ -0,0 +1,77 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+var _ = Describe("impersonatedTokenSource", func() {
+	var (
+		server      *httptest.Server
+		tokenSource *impersonatedTokenSource
+		status      int
+		requests    []string
+	)
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			requests = append(requests, r.URL.Path+" "+string(body))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			w.Write([]byte(`{"accessToken": "impersonated", "expireTime": "2020-01-01T01:00:00Z"}`))
+		}))
+
+		service, err := iamcredentials.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/"))
+		Expect(err).ToNot(HaveOccurred())
+		tokenSource = &impersonatedTokenSource{
+			ctx:            context.Background(),
+			service:        service,
+			serviceAccount: "reader@test-project.iam.gserviceaccount.com",
+			scopes:         []string{"https://www.googleapis.com/auth/monitoring.read"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("generates an access token for the service account", func() {
+		token, err := tokenSource.Token()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token.AccessToken).To(Equal("impersonated"))
+		Expect(token.Expiry).To(BeTemporally("==", time.Date(2020, 1, 1, 1, 0, 0, 0, time.UTC)))
+		Expect(requests).To(ConsistOf(
+			`/v1/projects/-/serviceAccounts/reader@test-project.iam.gserviceaccount.com:generateAccessToken {"scope":["https://www.googleapis.com/auth/monitoring.read"]}` + "\n",
+		))
+	})
+
+	It("fails when the service account can not be impersonated", func() {
+		status = http.StatusForbidden
+		_, err := tokenSource.Token()
+		Expect(err).To(MatchError(ContainSubstring("Error impersonating service account reader@test-project.iam.gserviceaccount.com")))
+	})
+})
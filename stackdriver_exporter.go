@@ -15,11 +15,15 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 
-	"github.com/PuerkitoBio/rehttp"
+	"cloud.google.com/go/compute/metadata"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
@@ -27,6 +31,10 @@ import (
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
+	"github.com/prometheus/exporter-toolkit/web"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/compute/v1"
@@ -42,16 +50,36 @@ var (
 		"web.listen-address", "Address to listen on for web interface and telemetry ($STACKDRIVER_EXPORTER_WEB_LISTEN_ADDRESS).",
 	).Envar("STACKDRIVER_EXPORTER_WEB_LISTEN_ADDRESS").Default(":9255").String()
 
+	webConfigFile = kingpin.Flag(
+		"web.config.file", "[EXPERIMENTAL] Path to a web configuration file enabling TLS or basic authentication ($STACKDRIVER_EXPORTER_WEB_CONFIG_FILE).",
+	).Envar("STACKDRIVER_EXPORTER_WEB_CONFIG_FILE").Default("").String()
+
 	metricsPath = kingpin.Flag(
 		"web.telemetry-path", "Path under which to expose Prometheus metrics ($STACKDRIVER_EXPORTER_WEB_TELEMETRY_PATH).",
 	).Envar("STACKDRIVER_EXPORTER_WEB_TELEMETRY_PATH").Default("/metrics").String()
 
+	configFile = kingpin.Flag(
+		"config.file", "Path to a YAML file with the Metric Type prefixes to collect and their options, taking precedence over the matching flags ($STACKDRIVER_EXPORTER_CONFIG_FILE).",
+	).Envar("STACKDRIVER_EXPORTER_CONFIG_FILE").String()
+
 	projectID = kingpin.Flag(
 		"google.project-id", "Comma seperated list of Google Project IDs ($STACKDRIVER_EXPORTER_GOOGLE_PROJECT_ID).",
 	).Envar("STACKDRIVER_EXPORTER_GOOGLE_PROJECT_ID").String()
 
+	impersonateServiceAccount = kingpin.Flag(
+		"google.impersonate-service-account", "Email of a Google service account to impersonate when calling the Stackdriver API ($STACKDRIVER_EXPORTER_GOOGLE_IMPERSONATE_SERVICE_ACCOUNT).",
+	).Envar("STACKDRIVER_EXPORTER_GOOGLE_IMPERSONATE_SERVICE_ACCOUNT").String()
+
+	stackdriverEndpoint = kingpin.Flag(
+		"stackdriver.endpoint", "Base URL of the Stackdriver Monitoring API, to use a private endpoint or a fake one. Defaults to the public endpoint ($STACKDRIVER_EXPORTER_ENDPOINT).",
+	).Envar("STACKDRIVER_EXPORTER_ENDPOINT").String()
+
+	listMetricDescriptors = kingpin.Flag(
+		"list-metric-descriptors", "Print the Google Stackdriver Monitoring Metric Descriptors starting with the configured prefixes and exit.",
+	).Default("false").Bool()
+
 	stackdriverMaxRetries = kingpin.Flag(
-		"stackdriver.max-retries", "Max number of retries that should be attempted on 503 errors from stackdriver. ($STACKDRIVER_EXPORTER_MAX_RETRIES)",
+		"stackdriver.max-retries", "Max number of retries that should be attempted on the retry statuses from stackdriver. ($STACKDRIVER_EXPORTER_MAX_RETRIES)",
 	).Envar("STACKDRIVER_EXPORTER_MAX_RETRIES").Default("0").Int()
 
 	stackdriverHttpTimeout = kingpin.Flag(
@@ -68,40 +96,88 @@ var (
 
 	stackdriverRetryStatuses = kingpin.Flag(
 		"stackdriver.retry-statuses", "The HTTP statuses that should trigger a retry ($STACKDRIVER_EXPORTER_RETRY_STATUSES)",
-	).Envar("STACKDRIVER_EXPORTER_RETRY_STATUSES").Default("503").Ints()
+	).Envar("STACKDRIVER_EXPORTER_RETRY_STATUSES").Default("429", "500", "503").Ints()
+
+	stackdriverCompression = kingpin.Flag(
+		"stackdriver.compression", "Request gzip compressed responses from the Stackdriver API, disable to save CPU at the cost of bandwidth ($STACKDRIVER_EXPORTER_COMPRESSION)",
+	).Envar("STACKDRIVER_EXPORTER_COMPRESSION").Default("true").Bool()
+
+	constLabels = kingpin.Flag(
+		"collector.const-label", "Label added to every exported metric, as `name=value`. Repeat for several labels ($STACKDRIVER_EXPORTER_COLLECTOR_CONST_LABELS).",
+	).Envar("STACKDRIVER_EXPORTER_COLLECTOR_CONST_LABELS").StringMap()
+
+	otlpEndpoint = kingpin.Flag(
+		"otlp.endpoint", "URL of an OTLP/HTTP endpoint to push the metrics to, ie http://localhost:4318/v1/metrics. Disabled when empty ($STACKDRIVER_EXPORTER_OTLP_ENDPOINT).",
+	).Envar("STACKDRIVER_EXPORTER_OTLP_ENDPOINT").String()
+
+	otlpPushInterval = kingpin.Flag(
+		"otlp.push-interval", "Interval between the pushes to the OTLP endpoint, each push having the interval to complete ($STACKDRIVER_EXPORTER_OTLP_PUSH_INTERVAL).",
+	).Envar("STACKDRIVER_EXPORTER_OTLP_PUSH_INTERVAL").Default("1m").Duration()
+
+	otlpHeaders = kingpin.Flag(
+		"otlp.header", "Header sent with the OTLP requests, as `name=value`. Repeat for several headers ($STACKDRIVER_EXPORTER_OTLP_HEADERS).",
+	).Envar("STACKDRIVER_EXPORTER_OTLP_HEADERS").StringMap()
 )
 
 func init() {
 	prometheus.MustRegister(version.NewCollector("stackdriver_exporter"))
 }
 
+// getDefaultGCPProject discovers the project from the Application Default
+// Credentials, or from the metadata server when running on GCE or GKE with
+// credentials not carrying a project (ie gcloud user credentials).
 func getDefaultGCPProject(ctx context.Context) (*string, error) {
 	credentials, err := google.FindDefaultCredentials(ctx, compute.ComputeScope)
-	if err != nil {
-		return nil, err
+	if err == nil && credentials.ProjectID != "" {
+		return &credentials.ProjectID, nil
 	}
-	if credentials.ProjectID == "" {
-		return nil, fmt.Errorf("unable to identify the gcloud project. Got empty string")
+	if err == nil {
+		err = fmt.Errorf("unable to identify the gcloud project. Got empty string")
 	}
-	return &credentials.ProjectID, nil
+
+	if metadata.OnGCE() {
+		projectID, metadataErr := metadata.ProjectID()
+		if metadataErr == nil && projectID != "" {
+			return &projectID, nil
+		}
+		if metadataErr != nil {
+			err = fmt.Errorf("%v, and from the metadata server: %v", err, metadataErr)
+		}
+	}
+	return nil, err
 }
 
 func createMonitoringService(ctx context.Context) (*monitoring.Service, error) {
-	googleClient, err := google.DefaultClient(ctx, monitoring.MonitoringReadScope)
+	var googleClient *http.Client
+	var err error
+	if *impersonateServiceAccount != "" {
+		googleClient, err = impersonatedClient(ctx, *impersonateServiceAccount, monitoring.MonitoringReadScope)
+	} else {
+		googleClient, err = google.DefaultClient(ctx, monitoring.MonitoringReadScope)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Error creating Google client: %v", err)
 	}
 
 	googleClient.Timeout = *stackdriverHttpTimeout
-	googleClient.Transport = rehttp.NewTransport(
-		googleClient.Transport, // need to wrap DefaultClient transport
-		rehttp.RetryAll(
-			rehttp.RetryMaxRetries(*stackdriverMaxRetries),
-			rehttp.RetryStatuses(*stackdriverRetryStatuses...)), // Cloud support suggests retrying on 503 errors
-		rehttp.ExpJitterDelay(*stackdriverBackoffJitterBase, *stackdriverMaxBackoffDuration), // Set timeout to <10s as that is prom default timeout
+	// Count the bytes received on the wire, before decompression
+	compressionTransport := collectors.NewCompressionTransport(googleClient.Transport, *stackdriverCompression)
+	prometheus.MustRegister(compressionTransport)
+
+	// Record the API quota of every attempt, including the retried ones
+	quotaTransport := collectors.NewQuotaTransport(compressionTransport)
+	prometheus.MustRegister(quotaTransport)
+
+	// Every API call is retried here, the collectors do not retry on top
+	googleClient.Transport = collectors.NewRetryTransport(
+		quotaTransport, // need to wrap DefaultClient transport
+		*stackdriverMaxRetries,
+		*stackdriverRetryStatuses,
+		*stackdriverBackoffJitterBase,
+		*stackdriverMaxBackoffDuration, // Set timeout to <10s as that is prom default timeout
 	)
 
-	monitoringService, err := monitoring.NewService(ctx, option.WithHTTPClient(googleClient))
+	monitoringService, err := newMonitoringService(ctx, googleClient, *stackdriverEndpoint)
 	if err != nil {
 		return nil, fmt.Errorf("Error creating Google Stackdriver Monitoring service: %v", err)
 	}
@@ -109,25 +185,85 @@ func createMonitoringService(ctx context.Context) (*monitoring.Service, error) {
 	return monitoringService, nil
 }
 
-func newHandler(projectIDs []string, m *monitoring.Service, logger log.Logger) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		collectParams := r.URL.Query()["collect"]
+// newMonitoringService returns a Stackdriver Monitoring API client calling the
+// given endpoint, or the public one when empty, with the HTTP client.
+func newMonitoringService(ctx context.Context, googleClient *http.Client, endpoint string) (*monitoring.Service, error) {
+	options := []option.ClientOption{option.WithHTTPClient(googleClient)}
+	if endpoint != "" {
+		options = append(options, option.WithEndpoint(endpoint))
+	}
+	return monitoring.NewService(ctx, options...)
+}
 
-		// Create filters for "collect" query parameters.
+// parseProjectIDs splits a comma separated list of project IDs, ignoring
+// surrounding whitespace, empty entries and duplicates.
+func parseProjectIDs(projectIDs string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, project := range strings.Split(projectIDs, ",") {
+		project = strings.TrimSpace(project)
+		if project == "" || seen[project] {
+			continue
+		}
+		seen[project] = true
+		result = append(result, project)
+	}
+	return result
+}
+
+// printMetricDescriptors prints the metric descriptors starting with the
+// configured prefixes for every project.
+func printMetricDescriptors(w io.Writer, projectIDs []string, m *monitoring.Service, options *collectors.MonitoringCollectorOptions, logger log.Logger) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tTYPE\tKIND\tVALUE TYPE\tUNIT\tDESCRIPTION")
+	for _, project := range projectIDs {
+		monitoringCollector, err := collectors.NewMonitoringCollector(project, m, options, prometheus.Labels(*constLabels), logger)
+		if err != nil {
+			return err
+		}
+		for _, prefix := range monitoringCollector.MetricsTypePrefixes() {
+			descriptors, err := monitoringCollector.ListMetricDescriptors(prefix)
+			if err != nil {
+				return fmt.Errorf("Error listing metric descriptors starting with %s for project %s: %v", prefix, project, err)
+			}
+			for _, descriptor := range descriptors {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", project, descriptor.Type, descriptor.MetricKind, descriptor.ValueType, descriptor.Unit, descriptor.Description)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// newMonitoringCollectors returns a collector per project. They are shared
+// by the metrics and health handlers, so their counters, caches and worker
+// pools survive between requests.
+func newMonitoringCollectors(projectIDs []string, m *monitoring.Service, options *collectors.MonitoringCollectorOptions, logger log.Logger) ([]*collectors.MonitoringCollector, error) {
+	var monitoringCollectors []*collectors.MonitoringCollector
+	for _, project := range projectIDs {
+		monitoringCollector, err := collectors.NewMonitoringCollector(project, m, options, prometheus.Labels(*constLabels), logger)
+		if err != nil {
+			return nil, err
+		}
+		monitoringCollectors = append(monitoringCollectors, monitoringCollector)
+	}
+	return monitoringCollectors, nil
+}
+
+func newHandler(monitoringCollectors []*collectors.MonitoringCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Create filters for "collect" query parameters. They only filter
+		// what a scrape collects, so they can not grow the set of collectors.
 		filters := make(map[string]bool)
-		for _, param := range collectParams {
+		for _, param := range r.URL.Query()["collect"] {
 			filters[param] = true
 		}
 
 		registry := prometheus.NewRegistry()
 
-		for _, project := range projectIDs {
-			monitoringCollector, err := collectors.NewMonitoringCollector(project, m, filters, logger)
-			if err != nil {
-				level.Error(logger).Log("err", err)
-				os.Exit(1)
-			}
-			registry.MustRegister(monitoringCollector)
+		for _, monitoringCollector := range monitoringCollectors {
+			// Collect with the request context so the API calls are
+			// aborted when the scrape client disconnects
+			registry.MustRegister(monitoringCollector.WithFilters(r.Context(), filters))
 		}
 
 		gatherers := prometheus.Gatherers{
@@ -140,6 +276,47 @@ func newHandler(projectIDs []string, m *monitoring.Service, logger log.Logger) h
 	}
 }
 
+// newHealthHandler returns a handler checking the Google Stackdriver
+// Monitoring API can be reached for every project, replying 503 otherwise.
+func newHealthHandler(projectIDs []string, monitoringCollectors []*collectors.MonitoringCollector, logger log.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i, monitoringCollector := range monitoringCollectors {
+			if err := monitoringCollector.Ping(r.Context()); err != nil {
+				level.Warn(logger).Log("msg", "health check failed to reach Google Stackdriver Monitoring", "project_id", projectIDs[i], "err", err)
+				http.Error(w, fmt.Sprintf("project %s: %v", projectIDs[i], err), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Write([]byte("OK"))
+	}
+}
+
+// newOTLPMeterProvider returns a meter provider pushing the Time Series
+// reported by the collectors to the OTLP endpoint on an interval. Each push is
+// given the interval to complete, so pushes never pile up.
+func newOTLPMeterProvider(ctx context.Context, monitoringCollectors []*collectors.MonitoringCollector, logger log.Logger) (*sdkmetric.MeterProvider, error) {
+	exporter, err := otlpmetrichttp.New(
+		ctx,
+		otlpmetrichttp.WithEndpointURL(*otlpEndpoint),
+		otlpmetrichttp.WithHeaders(*otlpHeaders),
+		otlpmetrichttp.WithTimeout(*stackdriverHttpTimeout),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Flag `otlp.endpoint` is invalid: %v", err)
+	}
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		level.Error(logger).Log("msg", "error exporting metrics over OTLP", "err", err)
+	}))
+
+	reader := sdkmetric.NewPeriodicReader(
+		exporter,
+		sdkmetric.WithInterval(*otlpPushInterval),
+		sdkmetric.WithTimeout(*otlpPushInterval),
+		sdkmetric.WithProducer(collectors.NewOTLPProducer(monitoringCollectors, *otlpPushInterval)),
+	)
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), nil
+}
+
 func main() {
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
@@ -150,10 +327,23 @@ func main() {
 
 	logger := promlog.New(promlogConfig)
 
+	options, err := collectors.NewMonitoringCollectorOptions()
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+	if *configFile != "" {
+		config, err := collectors.LoadConfig(*configFile)
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to load config file", "err", err)
+			os.Exit(1)
+		}
+		options.ApplyConfig(config)
+	}
+
 	ctx := context.Background()
 	if *projectID == "" {
 		level.Info(logger).Log("msg", "no projectID was provided. Trying to discover it")
-		var err error
 		projectID, err = getDefaultGCPProject(ctx)
 		if err != nil {
 			level.Error(logger).Log("msg", "no explicit projectID and error trying to discover default GCloud project", "err", err)
@@ -171,23 +361,81 @@ func main() {
 		os.Exit(1)
 	}
 
-	projectIDs := strings.Split(*projectID, ",")
-	handlerFunc := newHandler(projectIDs, monitoringService, logger)
+	projectIDs := parseProjectIDs(*projectID)
+	if len(projectIDs) == 0 {
+		level.Error(logger).Log("msg", "Flag `google.project-id` does not list any project ID")
+		os.Exit(1)
+	}
+
+	if *listMetricDescriptors {
+		if err := printMetricDescriptors(os.Stdout, projectIDs, monitoringService, options, logger); err != nil {
+			level.Error(logger).Log("msg", "failed to list metric descriptors", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	monitoringCollectors, err := newMonitoringCollectors(projectIDs, monitoringService, options, logger)
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+	handlerFunc := newHandler(monitoringCollectors)
+	healthHandlerFunc := newHealthHandler(projectIDs, monitoringCollectors, logger)
+
+	var meterProvider *sdkmetric.MeterProvider
+	if *otlpEndpoint != "" {
+		if *otlpPushInterval <= 0 {
+			level.Error(logger).Log("msg", "Flag `otlp.push-interval` must be positive")
+			os.Exit(1)
+		}
+		meterProvider, err = newOTLPMeterProvider(ctx, monitoringCollectors, logger)
+		if err != nil {
+			level.Error(logger).Log("err", err)
+			os.Exit(1)
+		}
+		level.Info(logger).Log("msg", "Pushing metrics over OTLP", "endpoint", *otlpEndpoint, "interval", *otlpPushInterval)
+	}
 
 	http.Handle(*metricsPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handlerFunc))
+	http.HandleFunc("/healthz", healthHandlerFunc)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
              <head><title>Stackdriver Exporter</title></head>
              <body>
              <h1>Stackdriver Exporter</h1>
              <p><a href='` + *metricsPath + `'>Metrics</a></p>
+             <p><a href='/healthz'>Health</a></p>
              </body>
              </html>`))
 	})
 
 	level.Info(logger).Log("msg", "Listening on", "address", *listenAddress)
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+	server := &http.Server{Addr: *listenAddress}
+	go func() {
+		term := make(chan os.Signal, 1)
+		signal.Notify(term, os.Interrupt, syscall.SIGTERM)
+		<-term
+		level.Info(logger).Log("msg", "Received a termination signal, shutting down")
+		server.Shutdown(ctx)
+	}()
+	err = web.ListenAndServe(server, *webConfigFile, logger)
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	if err != nil {
 		level.Error(logger).Log("err", err)
+	}
+
+	if meterProvider != nil {
+		// Push the newest Time Series once more before exiting.
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *otlpPushInterval)
+		if err := meterProvider.Shutdown(shutdownCtx); err != nil {
+			level.Error(logger).Log("msg", "error shutting down the OTLP export", "err", err)
+		}
+		cancel()
+	}
+	if err != nil {
 		os.Exit(1)
 	}
 }
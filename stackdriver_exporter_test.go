@@ -0,0 +1,188 @@
+// Copyright 2020 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	. "github.com/onsi/ginkgo"
+	"github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"google.golang.org/api/monitoring/v3"
+	"google.golang.org/api/option"
+
+	"github.com/prometheus-community/stackdriver_exporter/collectors"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+var _ = Describe("parseProjectIDs", func() {
+	table.DescribeTable("splits the comma separated project IDs",
+		func(projectIDs string, expected []string) {
+			Expect(parseProjectIDs(projectIDs)).To(Equal(expected))
+		},
+		table.Entry("a single project", "project-a", []string{"project-a"}),
+		table.Entry("several projects", "project-a,project-b", []string{"project-a", "project-b"}),
+		table.Entry("surrounding whitespace", " project-a , project-b ", []string{"project-a", "project-b"}),
+		table.Entry("empty entries", "project-a,,project-b,", []string{"project-a", "project-b"}),
+		table.Entry("duplicates", "project-a,project-b,project-a", []string{"project-a", "project-b"}),
+		table.Entry("no projects", " , ", []string(nil)),
+	)
+})
+
+var _ = Describe("newMonitoringService", func() {
+	It("calls the configured endpoint", func() {
+		var paths []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}))
+		defer server.Close()
+
+		service, err := newMonitoringService(context.Background(), server.Client(), server.URL+"/")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = service.Projects.MetricDescriptors.List("projects/test-project").Do()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(paths).To(Equal([]string{"/v3/projects/test-project/metricDescriptors"}))
+	})
+
+	It("calls the public endpoint by default", func() {
+		service, err := newMonitoringService(context.Background(), http.DefaultClient, "")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(service.BasePath).To(Equal("https://monitoring.googleapis.com/"))
+	})
+})
+
+var _ = Describe("printMetricDescriptors", func() {
+	It("prints the metric descriptors of the configured prefixes", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"metricDescriptors": [{"type": "compute.googleapis.com/instance/cpu/utilization", "metricKind": "GAUGE", "valueType": "DOUBLE", "unit": "1", "description": "CPU utilization."}]}`))
+		}))
+		defer server.Close()
+
+		service, err := newMonitoringService(context.Background(), server.Client(), server.URL+"/")
+		Expect(err).ToNot(HaveOccurred())
+		options := &collectors.MonitoringCollectorOptions{
+			MetricsTypePrefixes:  []string{"compute.googleapis.com/"},
+			LookbackMultiplier:   1,
+			ShardTotal:           1,
+			DescriptorsBatchSize: 1,
+		}
+
+		var out bytes.Buffer
+		Expect(printMetricDescriptors(&out, []string{"test-project"}, service, options, log.NewNopLogger())).To(Succeed())
+		Expect(out.String()).To(Equal("" +
+			"PROJECT       TYPE                                             KIND   VALUE TYPE  UNIT  DESCRIPTION\n" +
+			"test-project  compute.googleapis.com/instance/cpu/utilization  GAUGE  DOUBLE      1     CPU utilization.\n"))
+	})
+})
+
+var _ = Describe("getDefaultGCPProject", func() {
+	var server *httptest.Server
+	var credentialsFile string
+
+	BeforeEach(func() {
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Metadata-Flavor", "Google")
+			if r.URL.Path == "/computeMetadata/v1/project/project-id" {
+				w.Write([]byte("metadata-project"))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}))
+
+		// User credentials do not carry a project
+		f, err := ioutil.TempFile("", "credentials")
+		Expect(err).ToNot(HaveOccurred())
+		_, err = f.WriteString(`{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "token"}`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+		credentialsFile = f.Name()
+
+		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credentialsFile)
+		os.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(server.URL, "http://"))
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("GOOGLE_APPLICATION_CREDENTIALS")
+		os.Unsetenv("GCE_METADATA_HOST")
+		os.Remove(credentialsFile)
+		server.Close()
+	})
+
+	It("falls back to the metadata server when the credentials carry no project", func() {
+		projectID, err := getDefaultGCPProject(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(*projectID).To(Equal("metadata-project"))
+	})
+})
+
+var _ = Describe("newHealthHandler", func() {
+	// newCollectors returns the collectors of a project calling an API which
+	// replies every request with the given status and body.
+	newCollectors := func(status int, body string) []*collectors.MonitoringCollector {
+		client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Header:     http.Header{"Content-Type": []string{"application/json"}},
+				Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+				Request:    req,
+			}, nil
+		})}
+		service, err := monitoring.NewService(context.Background(), option.WithHTTPClient(client), option.WithEndpoint("https://monitoring.example.com/"))
+		Expect(err).ToNot(HaveOccurred())
+
+		options := &collectors.MonitoringCollectorOptions{
+			MetricsTypePrefixes:  []string{"compute.googleapis.com/"},
+			LookbackMultiplier:   1,
+			ShardTotal:           1,
+			DescriptorsBatchSize: 1,
+		}
+		monitoringCollectors, err := newMonitoringCollectors([]string{"test-project"}, service, options, log.NewNopLogger())
+		Expect(err).ToNot(HaveOccurred())
+		return monitoringCollectors
+	}
+
+	It("replies 200 when the API can be reached", func() {
+		handler := newHealthHandler([]string{"test-project"}, newCollectors(http.StatusOK, `{"metricDescriptors":[]}`), log.NewNopLogger())
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(Equal("OK"))
+	})
+
+	It("replies 503 with the error when the API can not be reached", func() {
+		handler := newHealthHandler([]string{"test-project"}, newCollectors(http.StatusForbidden, `{"error":{"code":403,"message":"permission denied"}}`), log.NewNopLogger())
+
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+		Expect(recorder.Body.String()).To(ContainSubstring("project test-project"))
+		Expect(recorder.Body.String()).To(ContainSubstring("permission denied"))
+	})
+})
@@ -14,14 +14,45 @@
 package utils
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/fatih/camelcase"
 )
 
 var (
 	safeNameRE = regexp.MustCompile(`[^a-zA-Z0-9_]*$`)
+
+	// unitSuffixes maps Stackdriver metric units to Prometheus metric name
+	// suffixes. Dimensionless units map to an empty suffix.
+	// @see https://cloud.google.com/monitoring/api/ref_v3/rest/v3/projects.metricDescriptors#MetricDescriptor.FIELDS.unit
+	unitSuffixes = map[string]string{
+		"1":     "",
+		"%":     "percent",
+		"bit":   "bits",
+		"By":    "bytes",
+		"kBy":   "kilobytes",
+		"MBy":   "megabytes",
+		"GBy":   "gigabytes",
+		"TBy":   "terabytes",
+		"KiBy":  "kibibytes",
+		"MiBy":  "mebibytes",
+		"GiBy":  "gibibytes",
+		"TiBy":  "tebibytes",
+		"By/s":  "bytes_per_second",
+		"bit/s": "bits_per_second",
+		"ns":    "nanoseconds",
+		"us":    "microseconds",
+		"ms":    "milliseconds",
+		"s":     "seconds",
+		"min":   "minutes",
+		"h":     "hours",
+		"d":     "days",
+		"1/s":   "per_second",
+	}
 )
 
 func NormalizeMetricName(metricName string) string {
@@ -39,6 +70,60 @@ func NormalizeMetricName(metricName string) string {
 	return strings.Join(normalizedMetricName, "_")
 }
 
+// UnitSuffix returns the Prometheus metric name suffix for a Stackdriver
+// metric unit, and whether the unit is known.
+func UnitSuffix(unit string) (string, bool) {
+	suffix, ok := unitSuffixes[unit]
+	return suffix, ok
+}
+
+// ParsePrefixMap parses a list of `prefix:value` pairs into a map.
+func ParsePrefixMap(pairs []string) (map[string]string, error) {
+	prefixMap := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid `prefix:value` pair %q", pair)
+		}
+		prefixMap[parts[0]] = parts[1]
+	}
+	return prefixMap, nil
+}
+
 func ProjectResource(projectID string) string {
 	return "projects/" + projectID
 }
+
+// IsProjectScope reports whether a scope to collect is a project ID, rather
+// than an `organizations/<id>` or `folders/<id>` resource name.
+func IsProjectScope(scope string) bool {
+	return !strings.HasPrefix(scope, "organizations/") && !strings.HasPrefix(scope, "folders/")
+}
+
+// ScopeResource returns the resource name of a scope to collect.
+func ScopeResource(scope string) string {
+	if IsProjectScope(scope) {
+		return ProjectResource(scope)
+	}
+	return scope
+}
+
+// MetricDescriptorResource returns the resource name of the descriptor of a
+// metric type in a project.
+func MetricDescriptorResource(projectID string, metricType string) string {
+	return ProjectResource(projectID) + "/metricDescriptors/" + metricType
+}
+
+// SanitizeLabelValue replaces the invalid UTF-8 sequences of a label value
+// with the Unicode replacement character and strips its control characters.
+func SanitizeLabelValue(value string) string {
+	if utf8.ValidString(value) && strings.IndexFunc(value, unicode.IsControl) == -1 {
+		return value
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(value, string(utf8.RuneError)))
+}
@@ -26,8 +26,80 @@ var _ = Describe("NormalizeMetricName", func() {
 	})
 })
 
+var _ = Describe("UnitSuffix", func() {
+	It("returns the suffix of a known unit", func() {
+		suffix, ok := UnitSuffix("By")
+		Expect(ok).To(BeTrue())
+		Expect(suffix).To(Equal("bytes"))
+	})
+
+	It("returns an empty suffix for dimensionless units", func() {
+		suffix, ok := UnitSuffix("1")
+		Expect(ok).To(BeTrue())
+		Expect(suffix).To(BeEmpty())
+	})
+
+	It("reports unknown units", func() {
+		_, ok := UnitSuffix("{request}")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("ParsePrefixMap", func() {
+	It("returns a map of prefixes to values", func() {
+		prefixMap, err := ParsePrefixMap([]string{
+			"compute.googleapis.com/instance:1h",
+			"pubsub.googleapis.com/:resource.labels.zone=\"us-central1-a\"",
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(prefixMap).To(Equal(map[string]string{
+			"compute.googleapis.com/instance": "1h",
+			"pubsub.googleapis.com/":          "resource.labels.zone=\"us-central1-a\"",
+		}))
+	})
+
+	It("returns an error on invalid pairs", func() {
+		_, err := ParsePrefixMap([]string{"compute.googleapis.com/instance"})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
 var _ = Describe("ProjectResource", func() {
 	It("returns a project resource", func() {
 		Expect(ProjectResource("fake-project-1")).To(Equal("projects/fake-project-1"))
 	})
 })
+
+var _ = Describe("ScopeResource", func() {
+	It("returns a project resource for project IDs", func() {
+		Expect(IsProjectScope("fake-project-1")).To(BeTrue())
+		Expect(ScopeResource("fake-project-1")).To(Equal("projects/fake-project-1"))
+	})
+
+	It("returns organization and folder resources as is", func() {
+		Expect(IsProjectScope("organizations/123")).To(BeFalse())
+		Expect(ScopeResource("organizations/123")).To(Equal("organizations/123"))
+		Expect(IsProjectScope("folders/456")).To(BeFalse())
+		Expect(ScopeResource("folders/456")).To(Equal("folders/456"))
+	})
+})
+
+var _ = Describe("MetricDescriptorResource", func() {
+	It("returns a metric descriptor resource", func() {
+		Expect(MetricDescriptorResource("fake-project-1", "compute.googleapis.com/instance/cpu/usage_time")).To(Equal("projects/fake-project-1/metricDescriptors/compute.googleapis.com/instance/cpu/usage_time"))
+	})
+})
+
+var _ = Describe("SanitizeLabelValue", func() {
+	It("keeps valid label values", func() {
+		Expect(SanitizeLabelValue("us-central1-a ⚡")).To(Equal("us-central1-a ⚡"))
+	})
+
+	It("replaces invalid UTF-8 sequences", func() {
+		Expect(SanitizeLabelValue("bad\xff\xfevalue")).To(Equal("bad�value"))
+	})
+
+	It("strips control characters", func() {
+		Expect(SanitizeLabelValue("multi\nline\x00value\t")).To(Equal("multilinevalue"))
+	})
+})